@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"io/fs"
 	"os"
 	"path"
 	"runtime/debug"
@@ -11,11 +14,16 @@ import (
 	"github.com/rs/zerolog/log"
 	"gopkg.in/natefinch/lumberjack.v2"
 
+	"github.com/codemicro/bar/internal/config"
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
 	"github.com/codemicro/bar/internal/providers"
 )
 
 func main() {
+	configFile := flag.String("config", "", "path to config file (defaults to $XDG_CONFIG_HOME/cdmbar/config.toml)")
+	flag.Parse()
+
 	logFileName := "cdmbar.log"
 	if userHomeDir, err := os.UserHomeDir(); err == nil {
 		logFileName = path.Join(userHomeDir, logFileName)
@@ -27,13 +35,30 @@ func main() {
 		MaxAge:   14, // days
 	})).Level(zerolog.DebugLevel)
 
-	if err := run(); err != nil {
+	if err := run(*configFile); err != nil {
 		log.Fatal().Err(err).Msg("unhandled error")
 	}
 }
 
-func run() error {
+func run(configFile string) error {
+	conf, err := loadConfig(configFile, nil)
+	if err != nil {
+		return err
+	}
+
+	notifier := notify.NewDBus("cdmbar")
+	setNotifications := func(enabled bool) {
+		if enabled {
+			providers.SetNotifier(notifier)
+		} else {
+			providers.SetNotifier(notify.Discard)
+		}
+	}
+	setNotifications(conf.Notifications)
+
 	b := i3bar.New(os.Stdout, os.Stdin, syscall.SIGUSR1)
+	b.SetPauseSignals(conf.StopSignal, conf.ContSignal)
+	b.SetColorSet(conf.Theme)
 	if err := b.Initialise(); err != nil {
 		return err
 	}
@@ -43,19 +68,22 @@ func run() error {
 		commitHash = " " + commitHash
 	}
 
-	// Blocks registered first will be the rightmost in the status bar.
-	b.RegisterBlockGenerator(
-		providers.NewLaunchProgram("MINI", "/home/akp/.local/bin/minisettings"),
-		providers.NewDateTime(),
-		providers.NewPulseaudioVolume(),
-		providers.NewMemory(7, 5),
-		providers.NewCPU(20, 50),
-		providers.NewDisk("/", 30, 10),
-		providers.NewBattery("BAT0", 80, 30, 20),
-		providers.NewWiFi("wlp0s20f3", 75),
-		providers.NewIPAddress("wlp0s20f3"),
-		providers.NewAudioPlayer(32),
-	)
+	// Blocks registered first will be the rightmost in the status bar, but
+	// the config lists them from left to right.
+	for i := len(conf.Blocks) - 1; i >= 0; i -= 1 {
+		b.RegisterBlockGenerator(conf.Blocks[i])
+	}
+
+	b.SetReloadHandler(syscall.SIGHUP, func() ([]i3bar.BlockGenerator, error) {
+		newConf, err := loadConfig(configFile, conf)
+		if err != nil {
+			return nil, err
+		}
+		conf = newConf
+		b.SetColorSet(conf.Theme)
+		setNotifications(conf.Notifications)
+		return conf.Blocks, nil
+	})
 
 	if err := b.Emit([]*i3bar.Block{
 		{FullText: "cdmbar" + commitHash},
@@ -68,6 +96,29 @@ func run() error {
 	return b.StartLoop()
 }
 
+// loadConfig loads the config file at filename. If filename is empty, the
+// config file is loaded from the default location, falling back to the
+// built-in default config if there isn't one. previous is passed through to
+// config.Parse.
+func loadConfig(filename string, previous *config.Config) (*config.Config, error) {
+	if filename != "" {
+		return config.Load(filename, previous)
+	}
+
+	filename, err := config.DefaultPath()
+	if err != nil {
+		log.Warn().Err(err).Msg("could not determine config file location, using default config")
+		return config.Parse("default.toml", config.Default, previous)
+	}
+
+	conf, err := config.Load(filename, previous)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Info().Str("filename", filename).Msg("no config file found, using default config")
+		return config.Parse("default.toml", config.Default, previous)
+	}
+	return conf, err
+}
+
 func getCommitHash() string {
 	bi, ok := debug.ReadBuildInfo()
 	if !ok {
@@ -3,8 +3,20 @@ module github.com/codemicro/bar
 go 1.18
 
 require (
-	github.com/rs/zerolog v1.26.1 // indirect
-	github.com/samber/lo v1.11.0 // indirect
-	golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
-	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	github.com/BurntSushi/toml v1.6.0
+	github.com/godbus/dbus/v5 v5.1.0
+	github.com/josharian/native v1.1.0
+	github.com/mdlayher/genetlink v1.3.2
+	github.com/mdlayher/netlink v1.7.2
+	github.com/rs/zerolog v1.26.1
+	golang.org/x/sys v0.9.0
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+)
+
+require (
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/mdlayher/socket v0.4.1 // indirect
+	golang.org/x/net v0.11.0 // indirect
+	golang.org/x/sync v0.2.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
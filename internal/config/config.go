@@ -0,0 +1,495 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/providers"
+)
+
+// Default is the config used when no config file exists at the default
+// location.
+//
+//go:embed default.toml
+var Default []byte
+
+// Config is a parsed cdmbar config file.
+type Config struct {
+	// Blocks contains one generator per configured block, in the order they
+	// should be displayed from left to right.
+	Blocks []i3bar.BlockGenerator
+
+	// StopSignal and ContSignal are the signals i3bar is asked to send when
+	// the bar should pause and resume.
+	StopSignal syscall.Signal
+	ContSignal syscall.Signal
+
+	// Theme is the set of colours selected with the theme key.
+	Theme *i3bar.ColorSet
+
+	// Notifications is true if desktop notifications should be sent when a
+	// block crosses one of its thresholds.
+	Notifications bool
+
+	// blockKeys contains a string for each block that is identical for any
+	// two blocks with the same provider and options.
+	blockKeys []string
+}
+
+type rawConfig struct {
+	Blocks        []toml.Primitive           `toml:"block"`
+	StopSignal    string                     `toml:"stop_signal"`
+	ContSignal    string                     `toml:"cont_signal"`
+	Theme         string                     `toml:"theme"`
+	ThemesFile    string                     `toml:"themes_file"`
+	Themes        map[string]*i3bar.ColorSet `toml:"themes"`
+	Notifications bool                       `toml:"notifications"`
+}
+
+// signals contains the signals that can be used as stop and cont signals.
+// SIGSTOP is deliberately excluded, since cdmbar would not be able to handle
+// it itself, as are SIGUSR1 and SIGHUP, which are used to refresh and reload.
+var signals = map[string]syscall.Signal{
+	"SIGCONT":  syscall.SIGCONT,
+	"SIGTSTP":  syscall.SIGTSTP,
+	"SIGTTIN":  syscall.SIGTTIN,
+	"SIGTTOU":  syscall.SIGTTOU,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGWINCH": syscall.SIGWINCH,
+}
+
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, found := signals[name]
+	if !found {
+		return 0, fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, nil
+}
+
+// commonBlockKeys are keys that are valid in any block table, regardless of
+// the provider in use.
+var commonBlockKeys = []string{"provider", "colors"}
+
+// Error is a problem found in a specific part of a config file.
+type Error struct {
+	Filename string
+	// Line is the line of the file that the error relates to, starting at 1.
+	// A Line of zero means the line is unknown.
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.Filename, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.Filename, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// DefaultPath returns the location of the config file in the user's XDG
+// config directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdmbar", "config.toml"), nil
+}
+
+// Load reads and parses the config file at filename. See Parse for the meaning
+// of previous.
+func Load(filename string, previous *Config) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filename, data, previous)
+}
+
+// Parse parses the contents of a config file. filename is only used in error
+// messages.
+//
+// If previous is not nil, any block that has exactly the same provider and
+// options as a block in previous will reuse the generator from previous
+// instead of constructing a new one.
+func Parse(filename string, data []byte, previous *Config) (*Config, error) {
+	raw := rawConfig{
+		StopSignal:    "SIGUSR2",
+		ContSignal:    "SIGCONT",
+		Theme:         "gruvbox",
+		Notifications: true,
+	}
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, wrapTOMLError(filename, 0, err)
+	}
+
+	blockLines := findBlockLines(data)
+
+	reusable := make(map[string][]i3bar.BlockGenerator)
+	if previous != nil {
+		for i, key := range previous.blockKeys {
+			reusable[key] = append(reusable[key], previous.Blocks[i])
+		}
+	}
+
+	conf := &Config{
+		Notifications: raw.Notifications,
+	}
+
+	if conf.StopSignal, err = parseSignal(raw.StopSignal); err != nil {
+		return nil, &Error{Filename: filename, Line: findKeyLine(data, 0, "stop_signal"), Err: err}
+	}
+
+	if conf.ContSignal, err = parseSignal(raw.ContSignal); err != nil {
+		return nil, &Error{Filename: filename, Line: findKeyLine(data, 0, "cont_signal"), Err: err}
+	}
+
+	if conf.StopSignal == conf.ContSignal {
+		return nil, &Error{Filename: filename, Err: errors.New("stop_signal and cont_signal must be different")}
+	}
+
+	themes := raw.Themes
+	if raw.ThemesFile != "" {
+		fileThemes, err := loadThemesFile(filename, raw.ThemesFile)
+		if err != nil {
+			return nil, err
+		}
+		// Themes in the config file itself take precedence.
+		for name, theme := range raw.Themes {
+			fileThemes[name] = theme
+		}
+		themes = fileThemes
+	}
+
+	if conf.Theme, err = resolveTheme(raw.Theme, themes); err != nil {
+		return nil, &Error{Filename: filename, Line: findKeyLine(data, 0, "theme"), Err: err}
+	}
+
+	for i, rawBlock := range raw.Blocks {
+		var line int
+		if i < len(blockLines) {
+			line = blockLines[i]
+		}
+
+		var setKeys map[string]any
+		if err := md.PrimitiveDecode(rawBlock, &setKeys); err != nil {
+			return nil, wrapTOMLError(filename, line, err)
+		}
+
+		key, err := blockKey(setKeys)
+		if err != nil {
+			return nil, wrapTOMLError(filename, line, err)
+		}
+
+		if gens := reusable[key]; len(gens) != 0 {
+			conf.Blocks = append(conf.Blocks, gens[0])
+			conf.blockKeys = append(conf.blockKeys, key)
+			reusable[key] = gens[1:]
+			continue
+		}
+
+		gen, err := parseBlock(&md, rawBlock, setKeys)
+		if err != nil {
+			var nextLine int
+			if i+1 < len(blockLines) {
+				nextLine = blockLines[i+1]
+			}
+			if l := findErrorLine(data, line, nextLine, err); l != 0 {
+				line = l
+			}
+			return nil, wrapTOMLError(filename, line, err)
+		}
+
+		conf.Blocks = append(conf.Blocks, gen)
+		conf.blockKeys = append(conf.blockKeys, key)
+	}
+
+	// Options inside blocks have already been checked by parseBlock, so only
+	// top-level keys are of interest here.
+	for _, key := range md.Undecoded() {
+		if key[0] != "block" {
+			return nil, &Error{Filename: filename, Line: findUndecodedLine(data, key), Err: fmt.Errorf("unknown key %q", key.String())}
+		}
+	}
+
+	return conf, nil
+}
+
+// blockKey returns a string that is identical for any two blocks with the same
+// provider and options. setKeys should contain every key set in the block.
+func blockKey(setKeys map[string]any) (string, error) {
+	// Maps are marshalled with sorted keys, so the order that options are
+	// written in doesn't matter.
+	key, err := json.Marshal(setKeys)
+	if err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
+
+type unknownKeyError struct {
+	key string
+	// table is the name of the table inside the block that key was set in,
+	// or empty if it was set in the block itself.
+	table string
+	// known lists the keys that are allowed in table.
+	known []string
+}
+
+func (e *unknownKeyError) Error() string {
+	if e.table != "" {
+		return fmt.Sprintf("unknown key %q in %s (must be one of %s)", e.key, e.table, strings.Join(e.known, ", "))
+	}
+	return fmt.Sprintf("unknown option %q", e.key)
+}
+
+// colorRoles are the keys that can be set in a block's colors table.
+var colorRoles = optionNames(reflect.TypeOf(i3bar.ColorSet{}))
+
+// checkColorKeys returns an error if colors, the value of a block's colors
+// key, sets anything other than a colour role.
+func checkColorKeys(colors any) error {
+	table, ok := colors.(map[string]any)
+	if !ok {
+		// Anything that isn't a table is reported when it's decoded.
+		return nil
+	}
+
+	for key := range table {
+		if !colorRoles[key] {
+			known := make([]string, 0, len(colorRoles))
+			for role := range colorRoles {
+				known = append(known, role)
+			}
+			sort.Strings(known)
+			return &unknownKeyError{key: key, table: "colors", known: known}
+		}
+	}
+	return nil
+}
+
+func parseBlock(md *toml.MetaData, rawBlock toml.Primitive, setKeys map[string]any) (i3bar.BlockGenerator, error) {
+	var header struct {
+		Provider string          `toml:"provider"`
+		Colors   *i3bar.ColorSet `toml:"colors"`
+	}
+	if err := md.PrimitiveDecode(rawBlock, &header); err != nil {
+		return nil, err
+	}
+
+	if header.Provider == "" {
+		return nil, errors.New("block has no provider set")
+	}
+
+	if !providers.IsRegistered(header.Provider) {
+		return nil, fmt.Errorf("unknown provider %q (must be one of %s)", header.Provider, strings.Join(providers.Names(), ", "))
+	}
+
+	if err := checkColorKeys(setKeys["colors"]); err != nil {
+		return nil, err
+	}
+
+	gen, err := providers.New(header.Provider, func(v any) error {
+		known := optionNames(reflect.TypeOf(v))
+		for _, key := range commonBlockKeys {
+			known[key] = true
+		}
+		for key := range setKeys {
+			if !known[key] {
+				return &unknownKeyError{key: key}
+			}
+		}
+		return md.PrimitiveDecode(rawBlock, v)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Colors != nil {
+		gen = i3bar.WithColorSet(gen, header.Colors)
+	}
+
+	return gen, nil
+}
+
+// optionNames returns the set of TOML keys that can be decoded into the
+// struct (or pointer to a struct) of type t.
+func optionNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	names := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous {
+			for name := range optionNames(field.Type) {
+				names[name] = true
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+
+	return names
+}
+
+var blockHeaderRegexp = regexp.MustCompile(`^\s*\[\[\s*block\s*\]\]`)
+
+// findBlockLines returns the line number of each [[block]] table header in
+// data, in order.
+func findBlockLines(data []byte) []int {
+	var lines []int
+	for i, line := range strings.Split(string(data), "\n") {
+		if blockHeaderRegexp.MatchString(line) {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// findKeyLine returns the line number at which key is first set after the
+// line blockLine, or zero if it cannot be found within that block.
+func findKeyLine(data []byte, blockLine int, key string) int {
+	keyRegexp := regexp.MustCompile(`^\s*"?` + regexp.QuoteMeta(key) + `"?\s*=`)
+	lines := strings.Split(string(data), "\n")
+	for i := blockLine; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "[") {
+			break
+		}
+		if keyRegexp.MatchString(lines[i]) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// findTableLine returns the line number of the [name] table header between
+// the lines start and end, or zero if there isn't one. An end of zero searches
+// to the end of data.
+func findTableLine(data []byte, start, end int, name string) int {
+	// Spaces and quotes are allowed around the parts of a table name.
+	normalise := strings.NewReplacer(" ", "", "\t", "", `"`, "")
+	want := "[" + normalise.Replace(name) + "]"
+
+	lines := strings.Split(string(data), "\n")
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+	for i := start; i < end; i++ {
+		line, _, _ := strings.Cut(lines[i], "#")
+		if normalise.Replace(line) == want {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// findErrorLine returns the line that an error from parsing the block whose
+// header is on blockLine relates to, or zero if it isn't known. nextBlockLine
+// is the line of the following block's header, or zero if this is the last
+// block.
+func findErrorLine(data []byte, blockLine, nextBlockLine int, err error) int {
+	var (
+		ke *unknownKeyError
+		oe *providers.OptionError
+	)
+	switch {
+	case errors.As(err, &ke) && ke.table != "":
+		if table := findTableLine(data, blockLine, nextBlockLine, "block."+ke.table); table != 0 {
+			return findKeyLine(data, table, ke.key)
+		}
+		// The table was written inline, as in colors = { ... }.
+		return findKeyLine(data, blockLine, ke.table)
+	case errors.As(err, &ke):
+		return findKeyLine(data, blockLine, ke.key)
+	case errors.As(err, &oe):
+		return findKeyLine(data, blockLine, oe.Option)
+	}
+	return 0
+}
+
+// findUndecodedLine returns the line number of a key outside of any block
+// that wasn't decoded, or zero if it cannot be found.
+func findUndecodedLine(data []byte, key toml.Key) int {
+	// The key may be a whole table that isn't known, such as [foo].
+	if line := findTableLine(data, 0, 0, strings.Join(key, ".")); line != 0 {
+		return line
+	}
+
+	var table int
+	if len(key) > 1 {
+		if table = findTableLine(data, 0, 0, strings.Join(key[:len(key)-1], ".")); table == 0 {
+			return 0
+		}
+	}
+	return findKeyLine(data, table, key[len(key)-1])
+}
+
+// tomlDecodeErrorRegexp matches the errors returned by the TOML library when
+// a value cannot be decoded into the Go type it's destined for. These are not
+// returned as a toml.ParseError, so the line number has to be extracted from
+// the message.
+var tomlDecodeErrorRegexp = regexp.MustCompile(`^toml: (?:line (\d+) )?\(last key "([^"]*)"\): (.+)$`)
+
+// wrapTOMLError converts err into an *Error, taking the line number from err
+// if it is a TOML decoding error and using line otherwise.
+func wrapTOMLError(filename string, line int, err error) error {
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		msg := pe.Message
+		if pe.LastKey != "" {
+			msg = fmt.Sprintf("%s (key %q)", msg, pe.LastKey)
+		}
+		return &Error{Filename: filename, Line: pe.Position.Line, Err: errors.New(msg)}
+	}
+
+	if x := tomlDecodeErrorRegexp.FindStringSubmatch(err.Error()); x != nil {
+		if x[1] != "" {
+			line, _ = strconv.Atoi(x[1])
+		}
+		return &Error{Filename: filename, Line: line, Err: fmt.Errorf("%s (key %q)", x[3], x[2])}
+	}
+
+	return &Error{Filename: filename, Line: line, Err: err}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDefault(t *testing.T) {
+	conf, err := Parse("default.toml", Default, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Blocks) == 0 {
+		t.Error("default config has no blocks")
+	}
+}
+
+func TestParseErrorLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		wantLine int
+		wantErr  string
+	}{
+		{
+			name: "unknown option",
+			config: `[[block]]
+provider = "cpu"
+ok_threshold = 20
+warnign_threshold = 50
+`,
+			wantLine: 4,
+			wantErr:  `unknown option "warnign_threshold"`,
+		},
+		{
+			name: "invalid full format",
+			config: `[[block]]
+provider = "datetime"
+
+[[block]]
+provider = "cpu"
+ok_threshold = 20
+full_format = "{{.Percent"
+`,
+			wantLine: 7,
+			wantErr:  "invalid full_format",
+		},
+		{
+			name: "invalid short format",
+			config: `[[block]]
+provider = "cpu"
+short_format = "{{nope}}"
+`,
+			wantLine: 3,
+			wantErr:  "invalid short_format",
+		},
+		{
+			name: "unknown top-level key",
+			config: `theme = "gruvbox"
+notifcations = false
+
+[[block]]
+provider = "cpu"
+`,
+			wantLine: 2,
+			wantErr:  `unknown key "notifcations"`,
+		},
+		{
+			name: "unknown top-level table",
+			config: `[[block]]
+provider = "cpu"
+
+[colours]
+bad = "#f00"
+`,
+			wantLine: 4,
+			wantErr:  `unknown key "colours"`,
+		},
+		{
+			name: "unknown theme role",
+			config: `theme = "mine"
+
+[[block]]
+provider = "cpu"
+
+[themes.mine]
+bad = "#f00"
+badd = "#f00"
+`,
+			wantLine: 8,
+			wantErr:  `unknown key "themes.mine.badd"`,
+		},
+		{
+			name: "unknown colour role",
+			config: `[[block]]
+provider = "cpu"
+
+[block.colors]
+bad = "#f00"
+warnign = "#ff0"
+
+[[block]]
+provider = "datetime"
+`,
+			wantLine: 6,
+			wantErr:  `unknown key "warnign" in colors`,
+		},
+		{
+			name: "unknown colour role in inline table",
+			config: `[[block]]
+provider = "datetime"
+
+[block.colors]
+bad = "#f00"
+
+[[block]]
+provider = "cpu"
+colors = { badd = "#f00" }
+`,
+			wantLine: 9,
+			wantErr:  `unknown key "badd" in colors`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse("config.toml", []byte(test.config), nil)
+			if err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+
+			var ce *Error
+			if !errors.As(err, &ce) {
+				t.Fatalf("Parse returned %v, want an *Error", err)
+			}
+			if ce.Line != test.wantLine {
+				t.Errorf("error %q is on line %d, want %d", err, ce.Line, test.wantLine)
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %q, want it to contain %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseColors(t *testing.T) {
+	_, err := Parse("config.toml", []byte(`[[block]]
+provider = "cpu"
+
+[block.colors]
+bad = "#f00"
+accent = "#00f"
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
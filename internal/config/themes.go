@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/codemicro/bar/internal/i3bar"
+)
+
+// builtinThemes are the themes that can be used without defining them in a
+// config or themes file.
+var builtinThemes = map[string]*i3bar.ColorSet{
+	"gruvbox": i3bar.DefaultColorSet,
+	"solarized": {
+		Good:       &i3bar.Color{R: 0x85, G: 0x99, B: 0x00},
+		Warning:    &i3bar.Color{R: 0xb5, G: 0x89, B: 0x00},
+		Bad:        &i3bar.Color{R: 0xdc, G: 0x32, B: 0x2f},
+		Critical:   &i3bar.Color{R: 0xd3, G: 0x36, B: 0x82},
+		Info:       &i3bar.Color{R: 0x26, G: 0x8b, B: 0xd2},
+		Idle:       &i3bar.Color{R: 0x58, G: 0x6e, B: 0x75},
+		Accent:     &i3bar.Color{R: 0x6c, G: 0x71, B: 0xc4},
+		Background: &i3bar.Color{R: 0x00, G: 0x2b, B: 0x36},
+	},
+}
+
+type themesFile struct {
+	Themes map[string]*i3bar.ColorSet `toml:"themes"`
+}
+
+// loadThemesFile reads a file containing [themes.<name>] tables. If filename
+// is relative, it's resolved relative to the directory containing
+// configFilename.
+func loadThemesFile(configFilename, filename string) (map[string]*i3bar.ColorSet, error) {
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(configFilename), filename)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var f themesFile
+	md, err := toml.Decode(string(data), &f)
+	if err != nil {
+		return nil, wrapTOMLError(filename, 0, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) != 0 {
+		return nil, &Error{Filename: filename, Err: fmt.Errorf("unknown key %q", undecoded[0].String())}
+	}
+
+	if f.Themes == nil {
+		f.Themes = make(map[string]*i3bar.ColorSet)
+	}
+
+	return f.Themes, nil
+}
+
+// resolveTheme finds the theme called name, looking first in themes and then
+// in the built-in themes.
+func resolveTheme(name string, themes map[string]*i3bar.ColorSet) (*i3bar.ColorSet, error) {
+	if theme, found := themes[name]; found {
+		return theme, nil
+	}
+	if theme, found := builtinThemes[name]; found {
+		return theme, nil
+	}
+	return nil, fmt.Errorf("unknown theme %q", name)
+}
@@ -8,25 +8,70 @@ import (
 	"strings"
 )
 
+// ColorSet contains the colours used for each semantic role that a block can
+// be in. Any colour may be nil.
 type ColorSet struct {
-	Bad        *Color
-	Warning    *Color
-	Good       *Color
-	Background *Color
+	Bad        *Color `toml:"bad"`
+	Warning    *Color `toml:"warning"`
+	Good       *Color `toml:"good"`
+	Background *Color `toml:"background"`
+	// Foreground is used as the text colour of any block that doesn't set
+	// its own. If nil, i3bar's default is used.
+	Foreground *Color `toml:"foreground"`
+	Info       *Color `toml:"info"`
+	Idle       *Color `toml:"idle"`
+	Critical   *Color `toml:"critical"`
+	Accent     *Color `toml:"accent"`
+}
+
+// Merge returns a new ColorSet with the colours from c, using the colours
+// from fallback for any that are nil in c. Either may be nil.
+func (c *ColorSet) Merge(fallback *ColorSet) *ColorSet {
+	if c == nil {
+		c = new(ColorSet)
+	}
+	if fallback == nil {
+		fallback = new(ColorSet)
+	}
+
+	pick := func(x, y *Color) *Color {
+		if x != nil {
+			return x
+		}
+		return y
+	}
+
+	return &ColorSet{
+		Bad:        pick(c.Bad, fallback.Bad),
+		Warning:    pick(c.Warning, fallback.Warning),
+		Good:       pick(c.Good, fallback.Good),
+		Background: pick(c.Background, fallback.Background),
+		Foreground: pick(c.Foreground, fallback.Foreground),
+		Info:       pick(c.Info, fallback.Info),
+		Idle:       pick(c.Idle, fallback.Idle),
+		Critical:   pick(c.Critical, fallback.Critical),
+		Accent:     pick(c.Accent, fallback.Accent),
+	}
 }
 
 type Color struct {
 	R, G, B uint8
+	// A is the alpha channel of the colour, which is only used if HasAlpha
+	// is set. i3bar treats colours without an alpha channel as opaque.
+	A        uint8
+	HasAlpha bool
 }
 
+// NewColorFromHexString parses a colour in the form #RGB, #RGBA, #RRGGBB or
+// #RRGGBBAA. The leading # is optional.
 func NewColorFromHexString(hexString string) (*Color, error) {
 	hexString = strings.TrimPrefix(hexString, "#")
 
-	if !(len(hexString) == 3 || len(hexString) == 6) {
+	if !(len(hexString) == 3 || len(hexString) == 4 || len(hexString) == 6 || len(hexString) == 8) {
 		return nil, errors.New("invalid color length")
 	}
 
-	if len(hexString) == 3 {
+	if len(hexString) == 3 || len(hexString) == 4 {
 		var newHexString string
 		for _, char := range hexString {
 			newHexString += string(char) + string(char)
@@ -39,15 +84,34 @@ func NewColorFromHexString(hexString string) (*Color, error) {
 		return nil, err
 	}
 
-	return &Color{
+	c := &Color{
 		R: colorBytes[0], G: colorBytes[1], B: colorBytes[2],
-	}, nil
+	}
+
+	if len(colorBytes) == 4 {
+		c.A = colorBytes[3]
+		c.HasAlpha = true
+	}
+
+	return c, nil
 }
 
 func (c *Color) String() string {
+	if c.HasAlpha {
+		return "#" + hex.EncodeToString([]byte{c.R, c.G, c.B, c.A})
+	}
 	return "#" + hex.EncodeToString([]byte{c.R, c.G, c.B})
 }
 
+// Equal reports whether c and other represent the same colour. Two nil colours
+// are equal.
+func (c *Color) Equal(other *Color) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return *c == *other
+}
+
 func (c *Color) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + c.String() + `"`), nil
 }
@@ -70,3 +134,17 @@ func (c *Color) UnmarshalJSON(b []byte) error {
 	*c = *nc
 	return nil
 }
+
+func (c *Color) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Color) UnmarshalText(b []byte) error {
+	nc, err := NewColorFromHexString(string(b))
+	if err != nil {
+		return err
+	}
+
+	*c = *nc
+	return nil
+}
@@ -3,11 +3,12 @@ package i3bar
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,31 +18,113 @@ import (
 type generatorInfo struct {
 	Provider         BlockGenerator
 	HasClickConsumer bool
-	Last      *Block
+	Last             *Block
+
+	// source is the value that was registered with the bar, which may be a
+	// wrapper around Provider.
+	source BlockGenerator
+	// colors overrides the bar's colours for this generator only. May be
+	// nil.
+	colors *ColorSet
+
+	// refresh requests that the generator's worker calls Block immediately.
+	refresh chan struct{}
+	// stop is closed when the generator is removed from the bar.
+	stop    chan struct{}
+	removed bool
 }
 
+// requestRefresh asks the generator's worker to produce a new block as soon as
+// it is able to.
+func (g *generatorInfo) requestRefresh() {
+	select {
+	case g.refresh <- struct{}{}:
+	default: // a refresh is already pending
+	}
+}
+
+// ReloadFunc returns a new set of block generators to display, from left to
+// right. Generators that were already registered with the bar may be returned
+// again to keep them running.
+type ReloadFunc func() ([]BlockGenerator, error)
+
 type I3bar struct {
-	writer         io.Writer
-	reader         io.Reader
-	updateSignal   syscall.Signal
+	writer       io.Writer
+	reader       io.Reader
+	updateSignal syscall.Signal
+
+	reloadSignal syscall.Signal
+	reloadFunc   ReloadFunc
+
+	stopSignal syscall.Signal
+	contSignal syscall.Signal
+	pause      pauseState
+
+	colors     *ColorSet
+	colorsLock sync.RWMutex
 
-	generators []*generatorInfo
-	tickNumber uint8
+	generators     []*generatorInfo
+	generatorsLock sync.RWMutex
+
+	updates chan *blockUpdate
+
+	// emissionsAvoided counts the number of times that blocks were updated
+	// without any of them changing, meaning nothing needed to be emitted.
+	emissionsAvoided uint64
 }
 
 func New(writer io.Writer, reader io.Reader, updateSignal syscall.Signal) *I3bar {
 	return &I3bar{
-		writer:         writer,
-		reader:         reader,
-		updateSignal:   updateSignal,
+		writer:       writer,
+		reader:       reader,
+		updateSignal: updateSignal,
+		updates:      make(chan *blockUpdate, 16),
+		colors:       DefaultColorSet,
 	}
 }
 
+// SetColorSet sets the colours passed to block generators. Colours that are
+// nil in colors are taken from DefaultColorSet. This function may be called at
+// any time.
+func (b *I3bar) SetColorSet(colors *ColorSet) {
+	merged := colors.Merge(DefaultColorSet)
+
+	b.colorsLock.Lock()
+	defer b.colorsLock.Unlock()
+	b.colors = merged
+}
+
+// colorsFor returns the colours that should be used by gen.
+func (b *I3bar) colorsFor(gen *generatorInfo) *ColorSet {
+	b.colorsLock.RLock()
+	defer b.colorsLock.RUnlock()
+	if gen.colors == nil {
+		return b.colors
+	}
+	return gen.colors.Merge(b.colors)
+}
+
+// SetPauseSignals sets the signals that i3bar will send to pause and resume
+// the status bar, for example when it's hidden by a fullscreen window. While
+// paused, no blocks are generated. This function must be called before
+// Initialise.
+func (b *I3bar) SetPauseSignals(stop, cont syscall.Signal) {
+	b.stopSignal = stop
+	b.contSignal = cont
+}
+
 func (b *I3bar) Initialise() error {
-	capabilities, err := json.Marshal(map[string]any{
+	header := map[string]any{
 		"version":      1,
 		"click_events": true,
-	})
+	}
+
+	if b.stopSignal != 0 && b.contSignal != 0 {
+		header["stop_signal"] = int(b.stopSignal)
+		header["cont_signal"] = int(b.contSignal)
+	}
+
+	capabilities, err := json.Marshal(header)
 	if err != nil {
 		return err
 	}
@@ -53,11 +136,31 @@ func (b *I3bar) Initialise() error {
 	return nil
 }
 
-var defaultColorSet = &ColorSet{
-	Good:       &Color{0xb8, 0xbb, 0x26},
-	Bad:        &Color{251, 73, 52},
-	Warning:    &Color{250, 189, 47},
-	Background: &Color{0x28, 0x28, 0x28},
+// DefaultColorSet is the set of colours used if none are set with
+// SetColorSet.
+var DefaultColorSet = &ColorSet{
+	Good:       &Color{R: 0xb8, G: 0xbb, B: 0x26},
+	Bad:        &Color{R: 251, G: 73, B: 52},
+	Warning:    &Color{R: 250, G: 189, B: 47},
+	Background: &Color{R: 0x28, G: 0x28, B: 0x28},
+	Info:       &Color{R: 0x83, G: 0xa5, B: 0x98},
+	Idle:       &Color{R: 0x92, G: 0x83, B: 0x74},
+	Critical:   &Color{R: 0xcc, G: 0x24, B: 0x1d},
+	Accent:     &Color{R: 0xd3, G: 0x86, B: 0x9b},
+}
+
+// colorOverride wraps a BlockGenerator to give it its own colours. It is
+// unwrapped when registered with the bar.
+type colorOverride struct {
+	BlockGenerator
+	colors *ColorSet
+}
+
+// WithColorSet returns a value that can be registered with the bar in place of
+// bg to override some or all of the bar's colours for bg only. Colours that
+// are nil in colors are taken from the bar's colours.
+func WithColorSet(bg BlockGenerator, colors *ColorSet) BlockGenerator {
+	return &colorOverride{BlockGenerator: bg, colors: colors}
 }
 
 func (b *I3bar) Emit(blocks []*Block) error {
@@ -75,92 +178,193 @@ func (b *I3bar) Emit(blocks []*Block) error {
 	return nil
 }
 
+// SetReloadHandler sets a function that will be called to obtain a new set of
+// block generators when sig is received. This function should not be called
+// after StartLoop is called.
+func (b *I3bar) SetReloadHandler(sig syscall.Signal, fn ReloadFunc) {
+	b.reloadSignal = sig
+	b.reloadFunc = fn
+}
+
+func newGeneratorInfo(bg BlockGenerator) *generatorInfo {
+	metadata := new(generatorInfo)
+	metadata.source = bg
+
+	if co, ok := bg.(*colorOverride); ok {
+		bg = co.BlockGenerator
+		metadata.colors = co.colors
+	}
+
+	_, hasClickConsumer := bg.(ClickEventConsumer)
+
+	metadata.Provider = bg
+	metadata.HasClickConsumer = hasClickConsumer
+	metadata.refresh = make(chan struct{}, 1)
+	metadata.stop = make(chan struct{})
+
+	return metadata
+}
+
 // RegisterBlockGenerator registers a block generator with the status bar. This
 // function should not be called after StartLoop is called.
 func (b *I3bar) RegisterBlockGenerator(bg ...BlockGenerator) {
 	for _, bgx := range bg {
-		_, hasClickConsumer := bgx.(ClickEventConsumer)
-
-		metadata := new(generatorInfo)
-		metadata.Provider = bgx
-		metadata.HasClickConsumer = hasClickConsumer
-
-		b.generators = append([]*generatorInfo{metadata}, b.generators...)
+		b.generators = append([]*generatorInfo{newGeneratorInfo(bgx)}, b.generators...)
 	}
 }
 
-func (b *I3bar) StartLoop() error {
+// coalesceWindow is how long the bar waits for further block updates after
+// receiving one, so that blocks updating at around the same time are emitted
+// together.
+const coalesceWindow = 10 * time.Millisecond
 
-	// The ticker will start after the specified duration, not when we
-	// instantiate it. Circumventing that here by calling Emit now.
-	if err := b.tick(false); err != nil {
-		return err
+func (b *I3bar) StartLoop() error {
+	for _, gen := range b.generators {
+		go b.runGenerator(gen)
 	}
 
-	ticker := time.NewTicker(time.Second)
 	sigUpdate := make(chan os.Signal, 1)
 	signal.Notify(sigUpdate, os.Signal(b.updateSignal))
 
-	go b.consumerLoop(func() {
-		sigUpdate <- b.updateSignal
-	})
+	sigReload := make(chan os.Signal, 1)
+	if b.reloadFunc != nil {
+		signal.Notify(sigReload, os.Signal(b.reloadSignal))
+	}
+
+	sigStop := make(chan os.Signal, 1)
+	sigCont := make(chan os.Signal, 1)
+	if b.stopSignal != 0 && b.contSignal != 0 {
+		signal.Notify(sigStop, os.Signal(b.stopSignal))
+		signal.Notify(sigCont, os.Signal(b.contSignal))
+	}
+
+	go b.consumerLoop()
 
 	for {
 		select {
-		case <-sigUpdate:
-			if err := b.tick(true); err != nil {
-				log.Error().Err(err).Msg("could not tick")
+		case <-sigStop:
+			b.pause.pause()
+			log.Debug().Msg("paused")
+		case <-sigCont:
+			// Refreshes are requested before resuming so that workers
+			// waiting to resume don't generate two blocks in a row.
+			for _, gen := range b.generators {
+				gen.requestRefresh()
 			}
-		case <-ticker.C:
-			if err := b.tick(false); err != nil {
-				log.Error().Err(err).Msg("could not tick")
+			if b.pause.resume() {
+				log.Debug().Msg("resumed")
 			}
-		}
-	}
-}
-
-func (b *I3bar) tick(override bool) error {
-	var hasChanged bool
-	for _, gen := range b.generators {
-		if override || (gen.Provider.Frequency() == 0 && gen.Last == nil) || (gen.Provider.Frequency() != 0 && b.tickNumber%gen.Provider.Frequency() == 0) {
-			block, err := gen.Provider.Block(defaultColorSet)
-			if err != nil {
-				log.Error().Err(err).Str("generator", fmt.Sprintf("%T", gen.Provider)).Send()
-				block = &Block{
-					FullText:  "ERROR",
-					TextColor: defaultColorSet.Bad,
-				}
+		case <-sigReload:
+			if err := b.reload(); err != nil {
+				log.Error().Err(err).Msg("could not reload")
+			}
+		case <-sigUpdate:
+			for _, gen := range b.generators {
+				gen.requestRefresh()
 			}
-			if block == nil {
-				block = &Block{
-					FullText:  "MISSING",
-					TextColor: defaultColorSet.Warning,
+		case update := <-b.updates:
+			hasChanged := b.applyUpdate(update)
+
+			timeout := time.After(coalesceWindow)
+		coalesce:
+			for {
+				select {
+				case update := <-b.updates:
+					hasChanged = b.applyUpdate(update) || hasChanged
+				case <-timeout:
+					break coalesce
 				}
 			}
 
-			if block != gen.Last {
-				gen.Last = block
-				hasChanged = true
+			if hasChanged {
+				if err := b.emitCurrent(); err != nil {
+					log.Error().Err(err).Msg("could not emit blocks")
+				}
+			} else {
+				b.emissionsAvoided += 1
+				if b.emissionsAvoided%100 == 0 {
+					log.Debug().Uint64("emissionsAvoided", b.emissionsAvoided).Msg("skipped emitting unchanged blocks")
+				}
 			}
 		}
 	}
+}
 
-	if hasChanged {
-		var blocks []*Block
-		for _, gen := range b.generators {
+// applyUpdate stores the block contained in update and reports whether it
+// differs from the previous block for that generator.
+func (b *I3bar) applyUpdate(update *blockUpdate) bool {
+	if update.gen.removed {
+		return false
+	}
+	if update.block.Equal(update.gen.Last) {
+		return false
+	}
+	update.gen.Last = update.block
+	return true
+}
+
+// emitCurrent emits the most recent block from every generator. Generators
+// that are yet to produce a block are skipped.
+func (b *I3bar) emitCurrent() error {
+	var blocks []*Block
+	for _, gen := range b.generators {
+		if gen.Last != nil {
 			blocks = append(blocks, gen.Last)
 		}
-		if err := b.Emit(blocks); err != nil {
-			return err
+	}
+	return b.Emit(blocks)
+}
+
+// reload replaces the current set of generators with those returned by the
+// reload function. Generators that are no longer in use are stopped and closed
+// if they implement io.Closer. The protocol header is not resent, so i3bar
+// sees a continuation of the same stream.
+func (b *I3bar) reload() error {
+	newGenerators, err := b.reloadFunc()
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[BlockGenerator]*generatorInfo)
+	for _, gen := range b.generators {
+		existing[gen.source] = gen
+	}
+
+	var (
+		infos []*generatorInfo
+		added []*generatorInfo
+	)
+	for _, bg := range newGenerators {
+		if info, found := existing[bg]; found {
+			infos = append(infos, info)
+			delete(existing, bg)
+			continue
 		}
+		info := newGeneratorInfo(bg)
+		infos = append(infos, info)
+		added = append(added, info)
 	}
 
-	b.tickNumber += 1
+	b.generatorsLock.Lock()
+	b.generators = infos
+	b.generatorsLock.Unlock()
 
-	return nil
+	for _, gen := range existing {
+		gen.removed = true
+		// The generator's worker closes the provider once it has stopped.
+		close(gen.stop)
+	}
+
+	for _, gen := range added {
+		go b.runGenerator(gen)
+	}
+
+	log.Info().Int("numGenerators", len(infos)).Int("numRemoved", len(existing)).Msg("reloaded generators")
+
+	return b.emitCurrent()
 }
 
-func (b *I3bar) consumerLoop(requestBarRefresh func()) {
+func (b *I3bar) consumerLoop() {
 	r := bufio.NewReader(b.reader)
 	for {
 		inputBytes, err := r.ReadBytes('\n')
@@ -180,15 +384,26 @@ func (b *I3bar) consumerLoop(requestBarRefresh func()) {
 			continue // idk what this could be but it's not relevant so BYE!
 		}
 
+		// OnClick can take a while, such as when a provider waits for a
+		// command to finish, and mustn't stop the generators from being
+		// replaced in the meantime, so the matching generators are found
+		// before calling it.
+		var consumers []*generatorInfo
+		b.generatorsLock.RLock()
 		for _, consumer := range b.generators {
 			if !consumer.HasClickConsumer {
 				continue
 			}
 			consumerName, consumerInstance := consumer.Provider.GetNameAndInstance()
 			if consumerName == event.Name && (consumerName == "" || consumerInstance == event.Instance) {
-				if consumer.Provider.(ClickEventConsumer).OnClick(event) {
-					requestBarRefresh()
-				}
+				consumers = append(consumers, consumer)
+			}
+		}
+		b.generatorsLock.RUnlock()
+
+		for _, consumer := range consumers {
+			if consumer.Provider.(ClickEventConsumer).OnClick(event) {
+				consumer.requestRefresh()
 			}
 		}
 	}
@@ -214,10 +429,31 @@ type Block struct {
 	Markup              string `json:"markup,omitempty"`
 }
 
+// Equal reports whether b and other have identical contents. Two nil blocks
+// are equal.
+func (b *Block) Equal(other *Block) bool {
+	if b == nil || other == nil {
+		return b == other
+	}
+
+	if !b.TextColor.Equal(other.TextColor) || !b.BackgroundColor.Equal(other.BackgroundColor) || !b.BorderColor.Equal(other.BorderColor) {
+		return false
+	}
+
+	// With the colours already compared by value, the remaining fields can
+	// be compared directly.
+	x, y := *b, *other
+	x.TextColor, x.BackgroundColor, x.BorderColor = nil, nil, nil
+	y.TextColor, y.BackgroundColor, y.BorderColor = nil, nil, nil
+	return x == y
+}
+
 type ProvidesNameAndInstance interface {
 	GetNameAndInstance() (name, instance string)
 }
 
+// BlockGenerator produces blocks for the status bar. Each BlockGenerator runs
+// in its own goroutine, so a slow call to Block does not hold up any others.
 type BlockGenerator interface {
 	ProvidesNameAndInstance
 	Block(*ColorSet) (*Block, error)
@@ -226,9 +462,52 @@ type BlockGenerator interface {
 	//
 	// A frequency of zero means that the Block method will only be called
 	// once, ever.
+	//
+	// Frequency is ignored if the BlockGenerator implements
+	// ScheduledGenerator.
 	Frequency() uint8
 }
 
+// Schedule describes when a block should be updated.
+type Schedule struct {
+	// Interval is the time between calls to Block. An Interval of zero means
+	// that the Block method will only be called once, ever.
+	Interval time.Duration
+	// Align causes calls to Block to happen on wall-clock multiples of
+	// Interval (for example, exactly on every second or minute) instead of
+	// Interval after the previous call.
+	Align bool
+}
+
+// ScheduledGenerator may be implemented by a BlockGenerator that needs an
+// update interval that cannot be expressed with Frequency.
+type ScheduledGenerator interface {
+	// Schedule is called after every call to Block, so may return a
+	// different result each time.
+	Schedule() Schedule
+}
+
+// WatchingGenerator may be implemented by a BlockGenerator that is able to
+// detect when the state it displays changes, so the block can be updated
+// immediately instead of waiting to be polled.
+type WatchingGenerator interface {
+	// Watch is run in its own goroutine for as long as the BlockGenerator is
+	// part of the bar, and should call notify whenever a new block should be
+	// generated. Watch must return once ctx is cancelled.
+	//
+	// If Watch returns before ctx is cancelled, it will be restarted after a
+	// delay. Polling using Frequency or Schedule continues alongside Watch.
+	Watch(ctx context.Context, notify func()) error
+}
+
+// TimeoutGenerator may be implemented by a BlockGenerator to override
+// DefaultTimeout.
+type TimeoutGenerator interface {
+	// Timeout returns how long a call to Block may take before a timeout
+	// block is displayed in its place.
+	Timeout() time.Duration
+}
+
 type ClickEvent struct {
 	Name      string          `json:"name"`
 	Instance  string          `json:"instance"`
@@ -248,7 +527,7 @@ type ClickEventConsumer interface {
 	ProvidesNameAndInstance
 	// OnClick is called when a new ClickEvent is recieved with the
 	// corresponding name and instance is recieved. If OnClick returns true, a
-	// refresh of the entire statusbar will be performed.
+	// refresh of the block will be performed.
 	//
 	// OnClick must not modify the ClickEvent as it may be reused elsewhere.
 	OnClick(*ClickEvent) (shouldRefresh bool)
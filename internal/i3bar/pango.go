@@ -0,0 +1,130 @@
+package i3bar
+
+import (
+	"fmt"
+	"strings"
+)
+
+var pangoEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"'", "&#39;",
+	`"`, "&quot;",
+)
+
+// EscapePango escapes s so that it can be included in Pango markup without
+// being interpreted as markup itself.
+func EscapePango(s string) string {
+	return pangoEscaper.Replace(s)
+}
+
+// SpanStyle contains the attributes of a Pango span. Empty fields are omitted
+// from the generated markup.
+type SpanStyle struct {
+	Foreground *Color
+	Background *Color
+	// Font is a font description, for example "Font Awesome 6 Free 10".
+	Font string
+	// Weight is a font weight such as "bold", "light" or "800".
+	Weight string
+	// Style is one of "normal", "oblique" or "italic".
+	Style string
+	// Size is a font size such as "small", "x-large" or "10pt".
+	Size string
+	// Underline is one of "none", "single", "double" or "low".
+	Underline string
+}
+
+func (s SpanStyle) attributes() string {
+	var attrs []string
+	add := func(name, value string) {
+		if value != "" {
+			attrs = append(attrs, fmt.Sprintf(`%s="%s"`, name, EscapePango(value)))
+		}
+	}
+
+	if s.Foreground != nil {
+		add("foreground", s.Foreground.String())
+	}
+	if s.Background != nil {
+		add("background", s.Background.String())
+	}
+	add("font_desc", s.Font)
+	add("weight", s.Weight)
+	add("style", s.Style)
+	add("size", s.Size)
+	add("underline", s.Underline)
+
+	return strings.Join(attrs, " ")
+}
+
+// PangoText builds a string of Pango markup. All text added to a PangoText is
+// escaped, so it's safe to use with untrusted strings such as song titles.
+//
+// The zero value is an empty PangoText ready to use.
+type PangoText struct {
+	sb strings.Builder
+}
+
+// NewPangoText returns a PangoText containing text, which is escaped.
+func NewPangoText(text string) *PangoText {
+	return new(PangoText).Text(text)
+}
+
+// Text appends text without any styling.
+func (p *PangoText) Text(text string) *PangoText {
+	p.sb.WriteString(EscapePango(text))
+	return p
+}
+
+// Span appends text with the given style.
+func (p *PangoText) Span(style SpanStyle, text string) *PangoText {
+	return p.SpanPango(style, NewPangoText(text))
+}
+
+// SpanPango appends existing markup with the given style.
+func (p *PangoText) SpanPango(style SpanStyle, markup *PangoText) *PangoText {
+	attrs := style.attributes()
+	if attrs == "" {
+		p.sb.WriteString(markup.String())
+		return p
+	}
+	p.sb.WriteString("<span " + attrs + ">")
+	p.sb.WriteString(markup.String())
+	p.sb.WriteString("</span>")
+	return p
+}
+
+// Colored appends text with the given foreground colour. If color is nil, the
+// text is added without any styling.
+func (p *PangoText) Colored(color *Color, text string) *PangoText {
+	return p.Span(SpanStyle{Foreground: color}, text)
+}
+
+// Icon appends an icon, such as one from an icon font, using the given font
+// description. If font is empty, the default font is used.
+func (p *PangoText) Icon(icon string, font string) *PangoText {
+	return p.Span(SpanStyle{Font: font}, icon)
+}
+
+// Len returns the length of the generated markup in bytes.
+func (p *PangoText) Len() int {
+	return p.sb.Len()
+}
+
+func (p *PangoText) String() string {
+	return p.sb.String()
+}
+
+// SetPango sets the full and short text of b from Pango markup and marks the
+// block as containing Pango markup. short may be nil, in which case the
+// block's short text is cleared.
+func (b *Block) SetPango(full, short *PangoText) {
+	b.Markup = "pango"
+	b.FullText = full.String()
+	b.ShortText = ""
+	if short != nil {
+		b.ShortText = short.String()
+	}
+}
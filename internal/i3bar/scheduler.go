@@ -0,0 +1,277 @@
+package i3bar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTimeout is how long a call to a BlockGenerator's Block method may take
+// before a timeout block is displayed in its place, unless the generator
+// implements TimeoutGenerator.
+const DefaultTimeout = 3 * time.Second
+
+// watchRestartDelay is how long to wait before restarting a WatchingGenerator's
+// Watch method if it returns unexpectedly.
+const watchRestartDelay = 10 * time.Second
+
+// scheduleOf returns the schedule for bg, converting its Frequency into a
+// Schedule if it doesn't implement ScheduledGenerator.
+func scheduleOf(bg BlockGenerator) Schedule {
+	if sg, ok := bg.(ScheduledGenerator); ok {
+		return sg.Schedule()
+	}
+	return Schedule{Interval: time.Duration(bg.Frequency()) * time.Second}
+}
+
+// next returns the time at which Block should next be called, given that the
+// previous call started at previous. s.Interval must not be zero.
+func (s Schedule) next(previous time.Time) time.Time {
+	if s.Align {
+		// Truncate rounds relative to the zero time, which lines up with
+		// wall-clock seconds, minutes and hours.
+		return time.Now().Truncate(s.Interval).Add(s.Interval)
+	}
+	return previous.Add(s.Interval)
+}
+
+// pauseState allows generator workers to wait while the bar is paused.
+type pauseState struct {
+	lock sync.Mutex
+	// resumed is closed when the bar is resumed. It is nil if the bar is not
+	// paused.
+	resumed chan struct{}
+}
+
+func (p *pauseState) pause() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+}
+
+// resume unpauses the bar, reporting whether it was paused beforehand.
+func (p *pauseState) resume() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed == nil {
+		return false
+	}
+	close(p.resumed)
+	p.resumed = nil
+	return true
+}
+
+// wait blocks until the bar is not paused. It returns false if stop is closed
+// while waiting.
+func (p *pauseState) wait(stop <-chan struct{}) bool {
+	p.lock.Lock()
+	resumed := p.resumed
+	p.lock.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+type blockUpdate struct {
+	gen   *generatorInfo
+	block *Block
+}
+
+// runGenerator repeatedly calls gen's Block method on the schedule it
+// specifies and sends the results to b.updates, until gen is removed from the
+// bar.
+func (b *I3bar) runGenerator(gen *generatorInfo) {
+	timeout := DefaultTimeout
+	if tg, ok := gen.Provider.(TimeoutGenerator); ok {
+		timeout = tg.Timeout()
+	}
+
+	// Calls to Block and Watch can still be running when the generator is
+	// removed, so the provider is only closed once they have all returned.
+	var running sync.WaitGroup
+	defer func() {
+		running.Wait()
+		closeProvider(gen)
+	}()
+
+	if wg, ok := gen.Provider.(WatchingGenerator); ok {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			runWatcher(gen, wg)
+		}()
+	}
+
+	var last *Block
+
+	for {
+		if !b.pause.wait(gen.stop) {
+			return
+		}
+
+		// Any refresh requested up to now is satisfied by the block that's
+		// about to be generated.
+		select {
+		case <-gen.refresh:
+		default:
+		}
+
+		started := time.Now()
+
+		block, ok := b.generateWithTimeout(gen, timeout, last, &running)
+		if !ok {
+			return
+		}
+		last = block
+
+		var due <-chan time.Time
+		if sched := scheduleOf(gen.Provider); sched.Interval > 0 {
+			due = time.After(time.Until(sched.next(started)))
+		}
+
+		select {
+		case <-gen.stop:
+			return
+		case <-gen.refresh:
+		case <-due:
+		}
+	}
+}
+
+// closeProvider closes gen's provider if it implements io.Closer. It must only
+// be called once nothing else is using the provider.
+func closeProvider(gen *generatorInfo) {
+	closer, ok := gen.Provider.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		log.Error().Err(err).Str("generator", fmt.Sprintf("%T", gen.Provider)).Msg("could not close removed generator")
+	}
+}
+
+// runWatcher runs wg's Watch method until gen is removed from the bar,
+// restarting it if it returns early.
+func runWatcher(gen *generatorInfo, wg WatchingGenerator) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-gen.stop
+		cancel()
+	}()
+
+	for {
+		err := wg.Watch(ctx, gen.requestRefresh)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Str("generator", fmt.Sprintf("%T", gen.Provider)).Dur("restartDelay", watchRestartDelay).Msg("watcher stopped unexpectedly")
+
+		select {
+		case <-time.After(watchRestartDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// generateWithTimeout calls gen's Block method and sends the result to
+// b.updates. If the call takes longer than timeout, a timeout block based on
+// last is sent in the meantime and the real block is sent once it's ready.
+//
+// The block that was generated is returned. ok is false if gen was removed
+// from the bar while waiting, in which case the call to Block may still be
+// running until running is done.
+func (b *I3bar) generateWithTimeout(gen *generatorInfo, timeout time.Duration, last *Block, running *sync.WaitGroup) (block *Block, ok bool) {
+	colors := b.colorsFor(gen)
+
+	result := make(chan *Block, 1)
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		result <- generateBlock(gen.Provider, colors)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case block = <-result:
+	case <-timer.C:
+		log.Warn().Str("generator", fmt.Sprintf("%T", gen.Provider)).Dur("timeout", timeout).Msg("timed out waiting for block")
+		if !b.sendUpdate(gen, timeoutBlock(last, colors)) {
+			return nil, false
+		}
+		select {
+		case block = <-result:
+		case <-gen.stop:
+			return nil, false
+		}
+	case <-gen.stop:
+		return nil, false
+	}
+
+	return block, b.sendUpdate(gen, block)
+}
+
+func (b *I3bar) sendUpdate(gen *generatorInfo, block *Block) bool {
+	select {
+	case b.updates <- &blockUpdate{gen: gen, block: block}:
+		return true
+	case <-gen.stop:
+		return false
+	}
+}
+
+// generateBlock calls bg's Block method, replacing any error or missing block
+// with a placeholder block.
+func generateBlock(bg BlockGenerator, colors *ColorSet) *Block {
+	block, err := bg.Block(colors)
+	if err != nil {
+		log.Error().Err(err).Str("generator", fmt.Sprintf("%T", bg)).Send()
+		block = &Block{
+			FullText:  "ERROR",
+			TextColor: colors.Bad,
+		}
+	}
+	if block == nil {
+		block = &Block{
+			FullText:  "MISSING",
+			TextColor: colors.Warning,
+		}
+	}
+	if block.TextColor == nil {
+		block.TextColor = colors.Foreground
+	}
+	return block
+}
+
+// timeoutBlock returns a block to display while waiting for a generator that
+// has timed out. The previous block is shown with a warning colour if there is
+// one.
+func timeoutBlock(last *Block, colors *ColorSet) *Block {
+	if last == nil {
+		return &Block{
+			FullText:  "TIMEOUT",
+			TextColor: colors.Warning,
+		}
+	}
+	stale := *last
+	stale.TextColor = colors.Warning
+	stale.BackgroundColor = nil
+	return &stale
+}
@@ -0,0 +1,84 @@
+package i3bar
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowGenerator is a generator whose Block and Watch methods keep running
+// until release is closed.
+type slowGenerator struct {
+	started chan struct{}
+	release chan struct{}
+	// busy is the number of calls to Block and Watch that haven't returned.
+	busy int32
+	// busyWhenClosed is the value of busy when Close was called, or -1 if
+	// Close hasn't been called.
+	busyWhenClosed int32
+}
+
+func (g *slowGenerator) GetNameAndInstance() (string, string) { return "slow", "" }
+func (g *slowGenerator) Frequency() uint8                      { return 1 }
+func (g *slowGenerator) Timeout() time.Duration                { return time.Millisecond }
+
+func (g *slowGenerator) Block(*ColorSet) (*Block, error) {
+	atomic.AddInt32(&g.busy, 1)
+	defer atomic.AddInt32(&g.busy, -1)
+	close(g.started)
+	<-g.release
+	return &Block{FullText: "slow"}, nil
+}
+
+func (g *slowGenerator) Watch(ctx context.Context, notify func()) error {
+	atomic.AddInt32(&g.busy, 1)
+	defer atomic.AddInt32(&g.busy, -1)
+	<-ctx.Done()
+	// Keep using the generator for a while after being cancelled.
+	<-g.release
+	return ctx.Err()
+}
+
+func (g *slowGenerator) Close() error {
+	atomic.StoreInt32(&g.busyWhenClosed, atomic.LoadInt32(&g.busy))
+	return nil
+}
+
+func TestRemovedGeneratorClosedAfterBlockReturns(t *testing.T) {
+	b := New(nil, nil, 0)
+	g := &slowGenerator{
+		started:        make(chan struct{}),
+		release:        make(chan struct{}),
+		busyWhenClosed: -1,
+	}
+	gen := newGeneratorInfo(g)
+
+	done := make(chan struct{})
+	go func() {
+		b.runGenerator(gen)
+		close(done)
+	}()
+
+	<-g.started
+	close(gen.stop)
+
+	select {
+	case <-done:
+		t.Fatal("runGenerator returned while Block was still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if atomic.LoadInt32(&g.busyWhenClosed) != -1 {
+		t.Fatal("generator was closed while Block was still running")
+	}
+
+	close(g.release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runGenerator didn't return once Block had returned")
+	}
+	if busy := atomic.LoadInt32(&g.busyWhenClosed); busy != 0 {
+		t.Errorf("generator was closed with %d calls still running, want 0", busy)
+	}
+}
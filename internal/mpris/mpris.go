@@ -0,0 +1,479 @@
+// Package mpris tracks media players on the D-Bus session bus using the MPRIS
+// D-Bus interface specification.
+package mpris
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busNamePrefix   = "org.mpris.MediaPlayer2."
+	objectPath      = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	playerInterface = "org.mpris.MediaPlayer2.Player"
+
+	dbusInterface       = "org.freedesktop.DBus"
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+)
+
+// Playback statuses reported by players.
+const (
+	StatusPlaying = "Playing"
+	StatusPaused  = "Paused"
+	StatusStopped = "Stopped"
+)
+
+// ErrNoPlayer is returned when a command is sent to a player that doesn't
+// exist.
+var ErrNoPlayer = errors.New("mpris: no such player")
+
+// Metadata describes the current track of a player.
+type Metadata struct {
+	TrackID dbus.ObjectPath
+	Title   string
+	Artists []string
+	Album   string
+	Length  time.Duration
+}
+
+// Player is a snapshot of the state of a media player.
+type Player struct {
+	// BusName is the well-known name of the player, for example
+	// "org.mpris.MediaPlayer2.spotify".
+	BusName string
+	// Name is BusName without the MPRIS prefix, for example "spotify".
+	// Players that allow multiple instances add a suffix, such as
+	// "firefox.instance1234".
+	Name     string
+	Status   string
+	Metadata Metadata
+	// CanSeek reports whether the player supports changing the position of
+	// the current track.
+	CanSeek bool
+
+	position     time.Duration
+	positionTime time.Time
+	rate         float64
+	lastChanged  time.Time
+}
+
+// Position returns the position of the player in the current track. Players
+// don't report changes to their position as it advances, so this is estimated
+// from the last known position.
+func (p *Player) Position() time.Duration {
+	if p.Status != StatusPlaying {
+		return p.position
+	}
+	pos := p.position + time.Duration(float64(time.Since(p.positionTime))*p.rate)
+	if p.Metadata.Length > 0 && pos > p.Metadata.Length {
+		pos = p.Metadata.Length
+	}
+	return pos
+}
+
+// Client watches the session bus for media players and keeps track of their
+// state. All methods are safe to call from multiple goroutines.
+type Client struct {
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+
+	lock sync.Mutex
+	// players maps the unique bus name of each player to its state. Signals
+	// are sent from the unique name, not the well-known name.
+	players     map[string]*Player
+	subscribers map[chan struct{}]struct{}
+
+	done chan struct{}
+}
+
+// Connect connects to the session bus and finds any media players that are
+// already running.
+func Connect() (*Client, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn)
+}
+
+// NewClient returns a client that uses an existing connection. The client
+// takes ownership of conn and closes it when Close is called.
+func NewClient(conn *dbus.Conn) (*Client, error) {
+	c := &Client{
+		conn:        conn,
+		signals:     make(chan *dbus.Signal, 32),
+		players:     make(map[string]*Player),
+		subscribers: make(map[chan struct{}]struct{}),
+		done:        make(chan struct{}),
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchSender(dbusInterface),
+		dbus.WithMatchInterface(dbusInterface),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg0Namespace(strings.TrimSuffix(busNamePrefix, ".")),
+	); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(objectPath),
+		dbus.WithMatchInterface(propertiesInterface),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, playerInterface),
+	); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(objectPath),
+		dbus.WithMatchInterface(playerInterface),
+		dbus.WithMatchMember("Seeked"),
+	); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	conn.Signal(c.signals)
+
+	var names []string
+	if err := conn.BusObject().Call(dbusInterface+".ListNames", 0).Store(&names); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, busNamePrefix) {
+			continue
+		}
+		var owner string
+		if err := conn.BusObject().Call(dbusInterface+".GetNameOwner", 0, name).Store(&owner); err != nil {
+			continue
+		}
+		c.addPlayer(name, owner)
+	}
+
+	go c.handleSignals()
+
+	return c, nil
+}
+
+// Close disconnects from the session bus.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done returns a channel that's closed when the connection to the bus is
+// lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Subscribe returns a channel that receives a value whenever the state of any
+// player changes. Notifications are coalesced, so a slow receiver will only
+// see one notification for several changes. The returned function must be
+// called to stop receiving notifications.
+func (c *Client) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	c.lock.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.lock.Unlock()
+
+	return ch, func() {
+		c.lock.Lock()
+		delete(c.subscribers, ch)
+		c.lock.Unlock()
+	}
+}
+
+// notify must be called with c.lock held.
+func (c *Client) notify() {
+	for ch := range c.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Client) handleSignals() {
+	defer close(c.done)
+
+	for sig := range c.signals {
+		switch sig.Name {
+		case dbusInterface + ".NameOwnerChanged":
+			var name, oldOwner, newOwner string
+			if err := dbus.Store(sig.Body, &name, &oldOwner, &newOwner); err != nil {
+				continue
+			}
+			if oldOwner != "" {
+				c.removePlayer(oldOwner)
+			}
+			if newOwner != "" {
+				c.addPlayer(name, newOwner)
+			}
+
+		case propertiesInterface + ".PropertiesChanged":
+			var (
+				iface       string
+				changed     map[string]dbus.Variant
+				invalidated []string
+			)
+			if err := dbus.Store(sig.Body, &iface, &changed, &invalidated); err != nil || iface != playerInterface {
+				continue
+			}
+			c.updatePlayer(sig.Sender, changed)
+
+		case playerInterface + ".Seeked":
+			var position int64
+			if err := dbus.Store(sig.Body, &position); err != nil {
+				continue
+			}
+			c.lock.Lock()
+			if p, found := c.players[sig.Sender]; found {
+				p.position = time.Duration(position) * time.Microsecond
+				p.positionTime = time.Now()
+				c.notify()
+			}
+			c.lock.Unlock()
+		}
+	}
+}
+
+func (c *Client) object(owner string) dbus.BusObject {
+	return c.conn.Object(owner, objectPath)
+}
+
+func (c *Client) addPlayer(name, owner string) {
+	var props map[string]dbus.Variant
+	if err := c.object(owner).Call(propertiesInterface+".GetAll", 0, playerInterface).Store(&props); err != nil {
+		return
+	}
+
+	p := &Player{
+		BusName: name,
+		Name:    strings.TrimPrefix(name, busNamePrefix),
+		rate:    1,
+	}
+	applyProperties(p, props)
+	if v, ok := props["Position"].Value().(int64); ok {
+		p.position = time.Duration(v) * time.Microsecond
+	}
+
+	c.lock.Lock()
+	c.players[owner] = p
+	c.notify()
+	c.lock.Unlock()
+}
+
+func (c *Client) removePlayer(owner string) {
+	c.lock.Lock()
+	if _, found := c.players[owner]; found {
+		delete(c.players, owner)
+		c.notify()
+	}
+	c.lock.Unlock()
+}
+
+func (c *Client) updatePlayer(owner string, changed map[string]dbus.Variant) {
+	c.lock.Lock()
+	p, found := c.players[owner]
+	if !found {
+		c.lock.Unlock()
+		return
+	}
+	before := p.Position()
+	applyProperties(p, changed)
+	p.position = before
+	c.lock.Unlock()
+
+	// The position isn't included in PropertiesChanged, but changing track or
+	// status can move it, so it has to be fetched again.
+	var position int64
+	err := c.object(owner).Call(propertiesInterface+".Get", 0, playerInterface, "Position").Store(&position)
+
+	c.lock.Lock()
+	if p, found := c.players[owner]; found {
+		if err == nil {
+			p.position = time.Duration(position) * time.Microsecond
+		}
+		c.notify()
+	}
+	c.lock.Unlock()
+}
+
+// applyProperties updates p with properties from the Player interface.
+func applyProperties(p *Player, props map[string]dbus.Variant) {
+	p.lastChanged = time.Now()
+	p.positionTime = p.lastChanged
+
+	if v, ok := props["PlaybackStatus"].Value().(string); ok {
+		p.Status = v
+	}
+	if v, ok := props["Rate"].Value().(float64); ok && v > 0 {
+		p.rate = v
+	}
+	if v, ok := props["CanSeek"].Value().(bool); ok {
+		p.CanSeek = v
+	}
+	if v, ok := props["Metadata"].Value().(map[string]dbus.Variant); ok {
+		p.Metadata = parseMetadata(v)
+	}
+}
+
+func parseMetadata(m map[string]dbus.Variant) Metadata {
+	var md Metadata
+
+	if v, ok := m["mpris:trackid"].Value().(dbus.ObjectPath); ok {
+		md.TrackID = v
+	} else if v, ok := m["mpris:trackid"].Value().(string); ok {
+		// Some players incorrectly send the track ID as a string.
+		md.TrackID = dbus.ObjectPath(v)
+	}
+	md.Title, _ = m["xesam:title"].Value().(string)
+	md.Album, _ = m["xesam:album"].Value().(string)
+
+	switch v := m["xesam:artist"].Value().(type) {
+	case []string:
+		md.Artists = v
+	case string:
+		md.Artists = []string{v}
+	}
+
+	// The length should be an int64, but players don't always agree.
+	switch v := m["mpris:length"].Value().(type) {
+	case int64:
+		md.Length = time.Duration(v) * time.Microsecond
+	case uint64:
+		md.Length = time.Duration(v) * time.Microsecond
+	case int32:
+		md.Length = time.Duration(v) * time.Microsecond
+	case float64:
+		md.Length = time.Duration(v) * time.Microsecond
+	}
+
+	return md
+}
+
+// Players returns a snapshot of every player on the bus, ordered by name.
+func (c *Client) Players() []Player {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	players := make([]Player, 0, len(c.players))
+	for _, p := range c.players {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+	return players
+}
+
+// Active returns the player that's most relevant to show. Players named in
+// preferred are chosen first, in the order given, and matching ignores any
+// instance suffix. Otherwise, playing players are chosen over paused ones,
+// and the most recently changed player wins. ok is false if there are no
+// players.
+func (c *Client) Active(preferred []string) (player Player, ok bool) {
+	players := c.Players()
+	if len(players) == 0 {
+		return Player{}, false
+	}
+
+	rank := func(p *Player) int {
+		for i, name := range preferred {
+			if p.Name == name || strings.HasPrefix(p.Name, name+".") {
+				return i
+			}
+		}
+		return len(preferred)
+	}
+
+	statusRank := func(p *Player) int {
+		switch p.Status {
+		case StatusPlaying:
+			return 0
+		case StatusPaused:
+			return 1
+		}
+		return 2
+	}
+
+	best := &players[0]
+	for i := 1; i < len(players); i++ {
+		p := &players[i]
+		if r, br := rank(p), rank(best); r != br {
+			if r < br {
+				best = p
+			}
+			continue
+		}
+		if s, bs := statusRank(p), statusRank(best); s != bs {
+			if s < bs {
+				best = p
+			}
+			continue
+		}
+		if p.lastChanged.After(best.lastChanged) {
+			best = p
+		}
+	}
+
+	return *best, true
+}
+
+func (c *Client) ownerOf(busName string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for owner, p := range c.players {
+		if p.BusName == busName {
+			return owner, nil
+		}
+	}
+	return "", ErrNoPlayer
+}
+
+func (c *Client) call(busName, method string, args ...any) error {
+	owner, err := c.ownerOf(busName)
+	if err != nil {
+		return err
+	}
+	return c.object(owner).Call(playerInterface+"."+method, 0, args...).Err
+}
+
+// PlayPause toggles playback of the player with the given bus name.
+func (c *Client) PlayPause(busName string) error {
+	return c.call(busName, "PlayPause")
+}
+
+// Next skips to the next track.
+func (c *Client) Next(busName string) error {
+	return c.call(busName, "Next")
+}
+
+// Previous skips to the previous track.
+func (c *Client) Previous(busName string) error {
+	return c.call(busName, "Previous")
+}
+
+// SetPosition seeks to position in the given track. The track ID must match
+// the current track, otherwise the player ignores the request.
+func (c *Client) SetPosition(busName string, trackID dbus.ObjectPath, position time.Duration) error {
+	return c.call(busName, "SetPosition", trackID, position.Microseconds())
+}
+
+// Seek moves the position in the current track by offset, which can be
+// negative. Unlike SetPosition, it doesn't need the ID of the current track,
+// so it works with players that don't report one.
+func (c *Client) Seek(busName string, offset time.Duration) error {
+	return c.call(busName, "Seek", offset.Microseconds())
+}
@@ -0,0 +1,343 @@
+package mpris
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startBus starts a private dbus-daemon and returns its address.
+func startBus(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "bus.conf")
+	config := fmt.Sprintf(busConfig, filepath.Join(dir, "bus"))
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("dbus-daemon", "--nofork", "--print-address", "--config-file="+configPath)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("could not read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// fakePlayer is a media player exported on the bus.
+type fakePlayer struct {
+	conn *dbus.Conn
+
+	lock  sync.Mutex
+	props map[string]dbus.Variant
+	calls []string
+}
+
+// fakeProperties implements the Properties interface for a fakePlayer.
+type fakeProperties fakePlayer
+
+func (p *fakeProperties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	v, found := p.props[name]
+	if iface != playerInterface || !found {
+		return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("no property %s.%s", iface, name))
+	}
+	return v, nil
+}
+
+func (p *fakeProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	props := make(map[string]dbus.Variant, len(p.props))
+	for name, v := range p.props {
+		props[name] = v
+	}
+	return props, nil
+}
+
+// set changes a property, and sends PropertiesChanged if emit is true.
+func (p *fakePlayer) set(name string, value interface{}, emit bool) {
+	p.lock.Lock()
+	p.props[name] = dbus.MakeVariant(value)
+	p.lock.Unlock()
+
+	if emit {
+		changed := map[string]dbus.Variant{name: dbus.MakeVariant(value)}
+		_ = p.conn.Emit(objectPath, propertiesInterface+".PropertiesChanged", playerInterface, changed, []string{})
+	}
+}
+
+func (p *fakePlayer) record(call string) {
+	p.lock.Lock()
+	p.calls = append(p.calls, call)
+	p.lock.Unlock()
+}
+
+func (p *fakePlayer) PlayPause() *dbus.Error {
+	p.record("PlayPause")
+	return nil
+}
+
+func (p *fakePlayer) Next() *dbus.Error {
+	p.record("Next")
+	return nil
+}
+
+func (p *fakePlayer) Previous() *dbus.Error {
+	p.record("Previous")
+	return nil
+}
+
+func (p *fakePlayer) SetPosition(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	p.record(fmt.Sprintf("SetPosition %s %d", trackID, position))
+	return nil
+}
+
+// SeekBy is exported as Seek, which vet expects to implement io.Seeker.
+func (p *fakePlayer) SeekBy(offset int64) *dbus.Error {
+	p.record(fmt.Sprintf("Seek %d", offset))
+	return nil
+}
+
+// startPlayer exports a player with the given name and playback status.
+func startPlayer(t *testing.T, address, name, status string) *fakePlayer {
+	t.Helper()
+
+	p := &fakePlayer{
+		conn: connect(t, address),
+		props: map[string]dbus.Variant{
+			"PlaybackStatus": dbus.MakeVariant(status),
+			"Rate":           dbus.MakeVariant(1.0),
+			"CanSeek":        dbus.MakeVariant(true),
+			"Position":       dbus.MakeVariant(int64(0)),
+			"Metadata": dbus.MakeVariant(map[string]dbus.Variant{
+				"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/track/1")),
+				"xesam:title":   dbus.MakeVariant("First"),
+			}),
+		},
+	}
+	if err := p.conn.ExportWithMap(p, map[string]string{"SeekBy": "Seek"}, objectPath, playerInterface); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.conn.Export((*fakeProperties)(p), objectPath, propertiesInterface); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := p.conn.RequestName(busNamePrefix+name, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("could not own name %s: %v", name, err)
+	}
+	return p
+}
+
+func newTestClient(t *testing.T, address string) *Client {
+	t.Helper()
+
+	c, err := NewClient(connect(t, address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// waitFor waits until cond returns true, checking whenever the client reports
+// a change.
+func waitFor(t *testing.T, c *Client, what string, cond func() bool) {
+	t.Helper()
+
+	ch, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	timeout := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-ch:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func playerNames(c *Client) []string {
+	var names []string
+	for _, p := range c.Players() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestDiscovery(t *testing.T) {
+	address := startBus(t)
+
+	// Players that are already running are found when connecting.
+	startPlayer(t, address, "early", StatusPaused)
+	c := newTestClient(t, address)
+
+	players := c.Players()
+	if len(players) != 1 {
+		t.Fatalf("found players %q, want [early]", playerNames(c))
+	}
+	if p := players[0]; p.BusName != busNamePrefix+"early" || p.Status != StatusPaused ||
+		p.Metadata.Title != "First" || !p.CanSeek {
+		t.Errorf("got player %+v", p)
+	}
+
+	// Players that start later are found from NameOwnerChanged.
+	late := startPlayer(t, address, "late.instance42", StatusPlaying)
+	waitFor(t, c, "late player to appear", func() bool {
+		return len(c.Players()) == 2
+	})
+	if names := playerNames(c); names[1] != "late.instance42" {
+		t.Errorf("found players %q, want [early late.instance42]", names)
+	}
+
+	// Players are removed when they leave the bus.
+	_ = late.conn.Close()
+	waitFor(t, c, "late player to disappear", func() bool {
+		return len(c.Players()) == 1
+	})
+}
+
+func TestActive(t *testing.T) {
+	address := startBus(t)
+	startPlayer(t, address, "spotify", StatusPaused)
+	startPlayer(t, address, "firefox.instance1234", StatusPlaying)
+	startPlayer(t, address, "vlc", StatusStopped)
+	c := newTestClient(t, address)
+
+	tests := []struct {
+		preferred []string
+		want      string
+	}{
+		// Without preferences, playing players win.
+		{nil, "firefox.instance1234"},
+		{[]string{"spotify"}, "spotify"},
+		{[]string{"vlc", "spotify"}, "vlc"},
+		// Instance suffixes are ignored.
+		{[]string{"firefox", "spotify"}, "firefox.instance1234"},
+		// Missing players are skipped.
+		{[]string{"mpv", "spotify"}, "spotify"},
+		{[]string{"mpv"}, "firefox.instance1234"},
+	}
+
+	for _, test := range tests {
+		p, ok := c.Active(test.preferred)
+		if !ok {
+			t.Fatalf("Active(%q) found no player", test.preferred)
+		}
+		if p.Name != test.want {
+			t.Errorf("Active(%q) = %s, want %s", test.preferred, p.Name, test.want)
+		}
+	}
+}
+
+func TestPropertiesChanged(t *testing.T) {
+	address := startBus(t)
+	player := startPlayer(t, address, "spotify", StatusPaused)
+	c := newTestClient(t, address)
+
+	player.set("Position", int64(30*time.Second/time.Microsecond), false)
+	player.set("Metadata", map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/track/2")),
+		"xesam:title":   dbus.MakeVariant("Second"),
+		"xesam:artist":  dbus.MakeVariant([]string{"Someone"}),
+		"mpris:length":  dbus.MakeVariant(int64(3 * time.Minute / time.Microsecond)),
+	}, true)
+	player.set("PlaybackStatus", StatusPlaying, true)
+
+	waitFor(t, c, "track change", func() bool {
+		p, ok := c.Active(nil)
+		return ok && p.Status == StatusPlaying && p.Metadata.Title == "Second"
+	})
+
+	p, _ := c.Active(nil)
+	if p.Metadata.TrackID != "/track/2" || p.Metadata.Length != 3*time.Minute ||
+		len(p.Metadata.Artists) != 1 || p.Metadata.Artists[0] != "Someone" {
+		t.Errorf("got metadata %+v", p.Metadata)
+	}
+	// The position isn't sent with PropertiesChanged, so has to be fetched.
+	if pos := p.Position(); pos < 30*time.Second || pos > 3*time.Minute {
+		t.Errorf("position is %v, want at least 30s", pos)
+	}
+
+	if err := c.SetPosition(p.BusName, p.Metadata.TrackID, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	player.lock.Lock()
+	calls := player.calls
+	player.lock.Unlock()
+	if want := "SetPosition /track/2 60000000"; len(calls) != 1 || calls[0] != want {
+		t.Errorf("player received calls %q, want %q", calls, want)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	address := startBus(t)
+	player := startPlayer(t, address, "spotify", StatusPlaying)
+	c := newTestClient(t, address)
+
+	if err := c.Seek(busNamePrefix+"spotify", -5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Seek(busNamePrefix+"vlc", time.Second); err != ErrNoPlayer {
+		t.Errorf("seeking a missing player returned %v, want ErrNoPlayer", err)
+	}
+
+	player.lock.Lock()
+	calls := player.calls
+	player.lock.Unlock()
+	if want := "Seek -5000000"; len(calls) != 1 || calls[0] != want {
+		t.Errorf("player received calls %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,374 @@
+// Package nl80211 reads the state of wireless interfaces from the kernel using
+// the nl80211 generic netlink family.
+package nl80211
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+const familyName = "nl80211"
+
+// Commands and attributes from include/uapi/linux/nl80211.h.
+const (
+	cmdGetInterface = 5
+	cmdGetStation   = 17
+	cmdGetScan      = 32
+
+	attrIfindex   = 3
+	attrIfname    = 4
+	attrIftype    = 5
+	attrMac       = 6
+	attrStaInfo   = 21
+	attrWiphyFreq = 38
+	attrBSS       = 47
+	attrSSID      = 52
+
+	staInfoSignal    = 7
+	staInfoTxBitrate = 8
+	staInfoRxBitrate = 14
+	staInfoSignalAvg = 13
+
+	rateInfoBitrate   = 1
+	rateInfoBitrate32 = 5
+
+	bssBSSID               = 1
+	bssFrequency           = 2
+	bssInformationElements = 6
+	bssStatus              = 9
+
+	bssStatusAssociated = 1
+
+	ifTypeStation = 2
+
+	ieSSID = 0
+)
+
+// ErrNotFound is returned when an interface doesn't exist or isn't a wireless
+// interface.
+var ErrNotFound = errors.New("nl80211: no such wireless interface")
+
+// Interface is a wireless interface.
+type Interface struct {
+	Index int
+	Name  string
+	// Station is true if the interface is a client, as opposed to an access
+	// point or monitor.
+	Station bool
+	// Frequency is the frequency of the connection in MHz, or zero if not
+	// connected.
+	Frequency int
+
+	// ssid is only reported by newer kernels.
+	ssid string
+}
+
+// Link describes the connection of a wireless interface to an access point.
+type Link struct {
+	SSID      string
+	BSSID     net.HardwareAddr
+	Frequency int
+	// Signal is the signal strength in dBm.
+	Signal int
+	// TxBitrate and RxBitrate are in bits per second.
+	TxBitrate int
+	RxBitrate int
+}
+
+// Client is a connection to nl80211.
+type Client struct {
+	conn   *genetlink.Conn
+	family genetlink.Family
+}
+
+// Dial connects to nl80211. ErrNotFound is returned if the kernel doesn't
+// support nl80211.
+func Dial() (*Client, error) {
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := conn.GetFamily(familyName)
+	if err != nil {
+		_ = conn.Close()
+		// The family is only registered once cfg80211 is loaded, so if it
+		// doesn't exist there can't be any wireless interfaces.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("nl80211: %w", err)
+	}
+
+	return &Client{conn: conn, family: family}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) execute(command uint8, flags netlink.HeaderFlags, encode func(ae *netlink.AttributeEncoder)) ([]genetlink.Message, error) {
+	var data []byte
+	if encode != nil {
+		ae := netlink.NewAttributeEncoder()
+		encode(ae)
+		var err error
+		if data, err = ae.Encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.conn.Execute(genetlink.Message{
+		Header: genetlink.Header{
+			Command: command,
+			Version: c.family.Version,
+		},
+		Data: data,
+	}, c.family.ID, netlink.Request|flags)
+}
+
+// Interfaces returns every wireless interface.
+func (c *Client) Interfaces() ([]*Interface, error) {
+	msgs, err := c.execute(cmdGetInterface, netlink.Dump, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var interfaces []*Interface
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		iface := new(Interface)
+		for ad.Next() {
+			switch ad.Type() {
+			case attrIfindex:
+				iface.Index = int(ad.Uint32())
+			case attrIfname:
+				iface.Name = ad.String()
+			case attrIftype:
+				iface.Station = ad.Uint32() == ifTypeStation
+			case attrWiphyFreq:
+				iface.Frequency = int(ad.Uint32())
+			case attrSSID:
+				iface.ssid = string(ad.Bytes())
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+
+		// Devices without a network interface, such as P2P devices, have
+		// no name and aren't of interest.
+		if iface.Name != "" {
+			interfaces = append(interfaces, iface)
+		}
+	}
+
+	return interfaces, nil
+}
+
+// Interface returns the wireless interface with the given name.
+func (c *Client) Interface(name string) (*Interface, error) {
+	interfaces, err := c.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range interfaces {
+		if iface.Name == name {
+			return iface, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Link returns the connection of iface, or nil if it isn't connected.
+func (c *Client) Link(iface *Interface) (*Link, error) {
+	bss, err := c.associatedBSS(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	if bss == nil {
+		// Scan results expire, so the access point may not be listed even
+		// though the interface is connected to it.
+		if iface.ssid == "" {
+			return nil, nil
+		}
+		bss = &Link{SSID: iface.ssid, Frequency: iface.Frequency}
+	}
+
+	if err := c.readStation(iface, bss); err != nil {
+		return nil, err
+	}
+
+	return bss, nil
+}
+
+// associatedBSS finds the access point that iface is associated with from the
+// results of the last scan.
+func (c *Client) associatedBSS(iface *Interface) (*Link, error) {
+	msgs, err := c.execute(cmdGetScan, netlink.Dump, func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(attrIfindex, uint32(iface.Index))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		for ad.Next() {
+			if ad.Type() != attrBSS {
+				continue
+			}
+
+			var (
+				link       Link
+				associated bool
+			)
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					switch nad.Type() {
+					case bssBSSID:
+						link.BSSID = net.HardwareAddr(nad.Bytes())
+					case bssFrequency:
+						link.Frequency = int(nad.Uint32())
+					case bssInformationElements:
+						link.SSID = parseSSID(nad.Bytes())
+					case bssStatus:
+						associated = nad.Uint32() == bssStatusAssociated
+					}
+				}
+				return nil
+			})
+
+			if associated {
+				return &link, nil
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// parseSSID finds the SSID in a list of information elements.
+func parseSSID(ies []byte) string {
+	for len(ies) >= 2 {
+		id, length := ies[0], int(ies[1])
+		if len(ies) < 2+length {
+			break
+		}
+		if id == ieSSID {
+			ssid := ies[2 : 2+length]
+			// SSIDs are arbitrary bytes, but are almost always UTF-8.
+			return strings.ToValidUTF8(string(bytes.TrimRight(ssid, "\x00")), "�")
+		}
+		ies = ies[2+length:]
+	}
+	return ""
+}
+
+// readStation fills in the signal strength and bitrates of link from the
+// station information of the access point.
+func (c *Client) readStation(iface *Interface, link *Link) error {
+	msgs, err := c.execute(cmdGetStation, netlink.Dump, func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(attrIfindex, uint32(iface.Index))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return err
+		}
+
+		var (
+			mac       net.HardwareAddr
+			staInfo   []byte
+			hasSignal bool
+		)
+		for ad.Next() {
+			switch ad.Type() {
+			case attrMac:
+				mac = net.HardwareAddr(ad.Bytes())
+			case attrStaInfo:
+				staInfo = ad.Bytes()
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return err
+		}
+
+		if link.BSSID != nil && !bytes.Equal(mac, link.BSSID) {
+			continue
+		}
+
+		nad, err := netlink.NewAttributeDecoder(staInfo)
+		if err != nil {
+			return err
+		}
+		for nad.Next() {
+			switch nad.Type() {
+			case staInfoSignal:
+				if !hasSignal {
+					link.Signal = int(int8(nad.Uint8()))
+				}
+			case staInfoSignalAvg:
+				// The average is less jumpy, so is preferred if present.
+				link.Signal = int(int8(nad.Uint8()))
+				hasSignal = true
+			case staInfoTxBitrate:
+				nad.Nested(func(rad *netlink.AttributeDecoder) error {
+					link.TxBitrate = parseBitrate(rad)
+					return nil
+				})
+			case staInfoRxBitrate:
+				nad.Nested(func(rad *netlink.AttributeDecoder) error {
+					link.RxBitrate = parseBitrate(rad)
+					return nil
+				})
+			}
+		}
+		return nad.Err()
+	}
+
+	return nil
+}
+
+// parseBitrate reads a bitrate in bits per second from nested rate info
+// attributes.
+func parseBitrate(ad *netlink.AttributeDecoder) int {
+	var rate int
+	for ad.Next() {
+		switch ad.Type() {
+		case rateInfoBitrate32:
+			// The 32 bit bitrate is used for rates too high for 16 bits
+			// and is preferred when present.
+			rate = int(ad.Uint32())
+		case rateInfoBitrate:
+			if rate == 0 {
+				rate = int(ad.Uint16())
+			}
+		}
+	}
+	// Rates are in units of 100kbit/s.
+	return rate * 100 * 1000
+}
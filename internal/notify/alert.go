@@ -0,0 +1,113 @@
+package notify
+
+import "time"
+
+// DefaultInterval is the default minimum time between repeated notifications
+// from an Alert.
+const DefaultInterval = 10 * time.Minute
+
+// Level is the severity of a value compared to its thresholds.
+type Level uint8
+
+const (
+	LevelOK Level = iota
+	LevelWarning
+	LevelBad
+)
+
+// Thresholds are the values at which something becomes a warning or bad. A
+// threshold of zero is disabled.
+type Thresholds struct {
+	Warning float64
+	Bad     float64
+	// LowerIsWorse is true if values below the thresholds are bad, such as
+	// for battery charge, and false if values above them are bad, such as
+	// for CPU load.
+	LowerIsWorse bool
+}
+
+func (t Thresholds) worse(value, threshold float64) bool {
+	if threshold == 0 {
+		return false
+	}
+	if t.LowerIsWorse {
+		return value < threshold
+	}
+	return value > threshold
+}
+
+// Level returns the level of value without any hysteresis.
+func (t Thresholds) Level(value float64) Level {
+	if t.worse(value, t.Bad) {
+		return LevelBad
+	} else if t.worse(value, t.Warning) {
+		return LevelWarning
+	}
+	return LevelOK
+}
+
+// Alert decides when a value crossing its thresholds is worth notifying the
+// user about.
+//
+// Once a value has crossed a threshold, it must recover past the threshold by
+// at least Hysteresis before the alert clears. A notification is sent when
+// the level gets worse, but not if the same level was notified about less
+// than Interval ago, so a value that hovers around a threshold doesn't cause a
+// stream of notifications.
+//
+// The zero value is ready to use with no hysteresis and DefaultInterval.
+type Alert struct {
+	Hysteresis float64
+	Interval   time.Duration
+
+	level         Level
+	notifiedLevel Level
+	notifiedAt    time.Time
+}
+
+// Update records a new value and returns its level. notify is true if a
+// notification should be sent about the new level.
+func (a *Alert) Update(value float64, thresholds Thresholds) (level Level, notify bool) {
+	level = thresholds.Level(value)
+
+	if level < a.level {
+		// Only move to a better level once the value has recovered by
+		// the hysteresis margin.
+		worsened := value + a.Hysteresis
+		if thresholds.LowerIsWorse {
+			worsened = value - a.Hysteresis
+		}
+		if l := thresholds.Level(worsened); l > level {
+			level = l
+		}
+		if level > a.level {
+			level = a.level
+		}
+	}
+
+	previous := a.level
+	a.level = level
+
+	if level <= previous {
+		return level, false
+	}
+
+	interval := a.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+
+	if level <= a.notifiedLevel && time.Since(a.notifiedAt) < interval {
+		return level, false
+	}
+
+	a.notifiedLevel = level
+	a.notifiedAt = time.Now()
+	return level, true
+}
+
+// Reset clears the alert without sending a notification, for example because
+// a battery has started charging.
+func (a *Alert) Reset() {
+	a.level = LevelOK
+}
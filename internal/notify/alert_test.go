@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertUpdate(t *testing.T) {
+	type step struct {
+		value float64
+		// elapsed is how long ago the last notification is made to have
+		// been sent, if not zero.
+		elapsed    time.Duration
+		wantLevel  Level
+		wantNotify bool
+	}
+
+	higherIsWorse := Thresholds{Warning: 80, Bad: 90}
+	lowerIsWorse := Thresholds{Warning: 20, Bad: 10, LowerIsWorse: true}
+
+	tests := []struct {
+		name       string
+		hysteresis float64
+		thresholds Thresholds
+		steps      []step
+	}{
+		{
+			name:       "crossing thresholds",
+			thresholds: higherIsWorse,
+			steps: []step{
+				{value: 50, wantLevel: LevelOK},
+				{value: 85, wantLevel: LevelWarning, wantNotify: true},
+				{value: 87, wantLevel: LevelWarning},
+				{value: 95, wantLevel: LevelBad, wantNotify: true},
+				{value: 50, wantLevel: LevelOK},
+			},
+		},
+		{
+			name:       "hysteresis",
+			hysteresis: 5,
+			thresholds: higherIsWorse,
+			steps: []step{
+				{value: 85, wantLevel: LevelWarning, wantNotify: true},
+				// Not recovered by the hysteresis margin yet.
+				{value: 78, wantLevel: LevelWarning},
+				{value: 76, wantLevel: LevelWarning},
+				{value: 74, wantLevel: LevelOK},
+				{value: 95, wantLevel: LevelBad, wantNotify: true},
+				// Recovered from bad, but still a warning after the
+				// hysteresis margin.
+				{value: 86, wantLevel: LevelBad},
+				{value: 84, wantLevel: LevelWarning},
+			},
+		},
+		{
+			name:       "hysteresis when lower is worse",
+			hysteresis: 2,
+			thresholds: lowerIsWorse,
+			steps: []step{
+				{value: 50, wantLevel: LevelOK},
+				{value: 15, wantLevel: LevelWarning, wantNotify: true},
+				{value: 9, wantLevel: LevelBad, wantNotify: true},
+				{value: 11, wantLevel: LevelBad},
+				{value: 13, wantLevel: LevelWarning},
+				{value: 21, wantLevel: LevelWarning},
+				{value: 25, wantLevel: LevelOK},
+			},
+		},
+		{
+			name:       "rate limiting",
+			thresholds: higherIsWorse,
+			steps: []step{
+				{value: 85, wantLevel: LevelWarning, wantNotify: true},
+				{value: 50, wantLevel: LevelOK},
+				// Hovering around the threshold doesn't notify again.
+				{value: 85, elapsed: time.Minute, wantLevel: LevelWarning},
+				{value: 50, wantLevel: LevelOK},
+				// A worse level is always notified about.
+				{value: 95, elapsed: time.Minute, wantLevel: LevelBad, wantNotify: true},
+				{value: 50, wantLevel: LevelOK},
+				// But a less severe level than the last
+				// notification isn't.
+				{value: 85, elapsed: time.Minute, wantLevel: LevelWarning},
+				{value: 50, wantLevel: LevelOK},
+				// Once the interval has passed, the same level is
+				// notified about again.
+				{value: 85, elapsed: DefaultInterval + time.Second, wantLevel: LevelWarning, wantNotify: true},
+			},
+		},
+		{
+			name:       "disabled thresholds",
+			thresholds: Thresholds{Bad: 90},
+			steps: []step{
+				{value: 85, wantLevel: LevelOK},
+				{value: 95, wantLevel: LevelBad, wantNotify: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Alert{Hysteresis: test.hysteresis}
+			for i, s := range test.steps {
+				if s.elapsed != 0 {
+					a.notifiedAt = time.Now().Add(-s.elapsed)
+				}
+				level, notify := a.Update(s.value, test.thresholds)
+				if level != s.wantLevel || notify != s.wantNotify {
+					t.Errorf("step %d: Update(%v) = %v, %v, want %v, %v", i, s.value, level, notify, s.wantLevel, s.wantNotify)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertReset(t *testing.T) {
+	a := &Alert{Interval: time.Minute}
+	thresholds := Thresholds{Warning: 80}
+
+	if _, notify := a.Update(85, thresholds); !notify {
+		t.Fatal("first warning wasn't notified")
+	}
+	a.Reset()
+
+	// Resetting clears the level, but not when the last notification was
+	// sent.
+	if level, notify := a.Update(85, thresholds); level != LevelWarning || notify {
+		t.Errorf("Update after Reset = %v, %v, want %v, false", level, notify, LevelWarning)
+	}
+	a.Reset()
+	a.notifiedAt = time.Now().Add(-2 * time.Minute)
+	if _, notify := a.Update(85, thresholds); !notify {
+		t.Error("warning after the interval wasn't notified")
+	}
+}
@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"sync"
+
+	"github.com/codemicro/bar/internal/notify"
+	"github.com/rs/zerolog/log"
+)
+
+var notifierState = struct {
+	lock     sync.RWMutex
+	notifier notify.Notifier
+}{notifier: notify.Discard}
+
+// SetNotifier sets the Notifier used by all providers to send notifications
+// when their thresholds are crossed. By default, notifications are discarded.
+func SetNotifier(n notify.Notifier) {
+	notifierState.lock.Lock()
+	defer notifierState.lock.Unlock()
+	notifierState.notifier = n
+}
+
+func getNotifier() notify.Notifier {
+	notifierState.lock.RLock()
+	defer notifierState.lock.RUnlock()
+	return notifierState.notifier
+}
+
+// ThresholdAlert sends a notification when a provider's value crosses one of
+// its thresholds. Providers with thresholds embed a ThresholdAlert and call
+// check every time they generate a block.
+type ThresholdAlert struct {
+	Notify bool `toml:"notify"`
+
+	alert notify.Alert
+}
+
+func newThresholdAlert(hysteresis float64) ThresholdAlert {
+	return ThresholdAlert{
+		Notify: true,
+		alert:  notify.Alert{Hysteresis: hysteresis},
+	}
+}
+
+// check updates the alert with value and, if needed, sends a notification
+// with the given summary and body. tag identifies the provider so that a new
+// notification replaces an old one.
+func (t *ThresholdAlert) check(tag string, value float64, thresholds notify.Thresholds, summary, body string) {
+	level, shouldNotify := t.alert.Update(value, thresholds)
+	if !shouldNotify || !t.Notify {
+		return
+	}
+
+	n := &notify.Notification{
+		Summary: summary,
+		Body:    body,
+		Urgency: notify.UrgencyNormal,
+		Tag:     tag,
+	}
+	if level == notify.LevelBad {
+		n.Urgency = notify.UrgencyCritical
+	}
+
+	// Sending a notification can block for a while if the notification
+	// daemon is slow, which shouldn't hold up the block.
+	notifier := getNotifier()
+	go func() {
+		if err := notifier.Notify(n); err != nil {
+			log.Warn().Err(err).Str("location", "thresholdAlert_check").Msg("could not send notification")
+		}
+	}()
+}
+
+// reset clears the alert without sending a notification.
+func (t *ThresholdAlert) reset() {
+	t.alert.Reset()
+}
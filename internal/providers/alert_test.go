@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codemicro/bar/internal/notify"
+)
+
+// fakeNotifier records the notifications that are sent.
+type fakeNotifier chan *notify.Notification
+
+func (f fakeNotifier) Notify(n *notify.Notification) error {
+	f <- n
+	return nil
+}
+
+func useFakeNotifier(t *testing.T) fakeNotifier {
+	notifier := make(fakeNotifier, 16)
+	SetNotifier(notifier)
+	t.Cleanup(func() { SetNotifier(notify.Discard) })
+	return notifier
+}
+
+func TestThresholdAlert(t *testing.T) {
+	thresholds := notify.Thresholds{Warning: 20, Bad: 10, LowerIsWorse: true}
+
+	tests := []struct {
+		name   string
+		notify bool
+		values []float64
+		// want is the urgency of each notification that should be sent.
+		// Notifications are sent in the background, so can arrive in any
+		// order.
+		want []notify.Urgency
+	}{
+		{
+			name:   "warning then bad",
+			notify: true,
+			values: []float64{50, 15, 9},
+			want:   []notify.Urgency{notify.UrgencyNormal, notify.UrgencyCritical},
+		},
+		{
+			name:   "hysteresis",
+			notify: true,
+			// 21 hasn't recovered by the margin of 2, so dropping back
+			// to 19 isn't a new warning.
+			values: []float64{15, 21, 19, 23, 19},
+			want:   []notify.Urgency{notify.UrgencyNormal},
+		},
+		{
+			name:   "notify disabled",
+			notify: false,
+			values: []float64{50, 15, 9},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier := useFakeNotifier(t)
+
+			alert := newThresholdAlert(2)
+			alert.Notify = test.notify
+			for _, value := range test.values {
+				alert.check("battery", value, thresholds, "Low battery", "")
+			}
+
+			remaining := make(map[notify.Urgency]int)
+			for _, urgency := range test.want {
+				remaining[urgency]++
+			}
+			for i := range test.want {
+				select {
+				case n := <-notifier:
+					if remaining[n.Urgency] == 0 || n.Tag != "battery" || n.Summary != "Low battery" {
+						t.Errorf("got unexpected notification %+v", n)
+					}
+					remaining[n.Urgency]--
+				case <-time.After(time.Second):
+					t.Fatalf("got %d notifications, want %d", i, len(test.want))
+				}
+			}
+
+			select {
+			case n := <-notifier:
+				t.Errorf("got unexpected notification %+v", n)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestThresholdAlertReset(t *testing.T) {
+	notifier := useFakeNotifier(t)
+	thresholds := notify.Thresholds{Warning: 20, LowerIsWorse: true}
+
+	alert := newThresholdAlert(2)
+	alert.check("battery", 15, thresholds, "Low battery", "")
+	<-notifier
+
+	// A battery that starts charging and then discharges again shouldn't
+	// notify about the same level straight away.
+	alert.reset()
+	alert.check("battery", 15, thresholds, "Low battery", "")
+
+	select {
+	case n := <-notifier:
+		t.Errorf("got unexpected notification %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,33 +1,83 @@
 package providers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/mpris"
+	"github.com/rs/zerolog/log"
 )
 
 const (
-	musicNoteString     = "♪"
-	pausedIconString    = "⏸"
-	playerctlExecutable = "playerctl"
+	musicNoteString  = "♪"
+	pausedIconString = "⏸"
 
-	playerStatusStopped = "Stopped"
-	playerStatusPlaying = "Playing"
-	playerStatusPaused  = "Paused"
+	playerStatusStopped = mpris.StatusStopped
+	playerStatusPlaying = mpris.StatusPlaying
+	playerStatusPaused  = mpris.StatusPaused
 	playerStatusUnknown = "Unknown"
 )
 
-type AudioPlayer struct {
-	ShowTextOnPause bool
-	MaxLabelLen     int
-	TickerSteps     int
+var mprisConnection struct {
+	lock   sync.Mutex
+	client *mpris.Client
+}
+
+// getMprisClient returns a connection to the session bus that's shared between
+// all AudioPlayer blocks. If the previous connection was lost, a new one is
+// made.
+func getMprisClient() (*mpris.Client, error) {
+	mprisConnection.lock.Lock()
+	defer mprisConnection.lock.Unlock()
+
+	if c := mprisConnection.client; c != nil {
+		select {
+		case <-c.Done():
+			log.Debug().Msg("reconnecting to the session bus")
+		default:
+			return c, nil
+		}
+	}
 
-	name string
+	c, err := mpris.Connect()
+	if err != nil {
+		return nil, err
+	}
+	mprisConnection.client = c
+	return c, nil
+}
 
-	lastText     string
-	tickerCursor int
+type AudioPlayer struct {
+	ShowTextOnPause bool `toml:"show_text_on_pause"`
+	MaxLabelLen     int  `toml:"max_label_length"`
+	TickerSteps     int  `toml:"ticker_steps"`
+	// PreferredPlayers is a list of player names, such as "spotify", that
+	// are shown in preference to any others, in the order given. If none
+	// of them are running, the most recently active player is shown.
+	PreferredPlayers []string `toml:"preferred_players"`
+	// ShowAlbum adds the album name to the label.
+	ShowAlbum bool `toml:"show_album"`
+	// ShowTime shows the elapsed and total time of the current track.
+	ShowTime bool `toml:"show_time"`
+	// ProgressBarWidth is the width, in characters, of a bar showing the
+	// progress through the current track. Zero disables the bar.
+	ProgressBarWidth int `toml:"progress_bar_width"`
+	// FullFormat, if set, replaces the scrolling "Track - Artist" label.
+	// ShortFormat is used as the short text as normal.
+	TextFormat
+
+	name  string
+	watch watchState
+
+	lastText      string
+	tickerCursor  int
+	isAnimating   bool
+	isProgressing bool
 }
 
 func NewAudioPlayer(maxLabelLength int) *AudioPlayer {
@@ -39,64 +89,96 @@ func NewAudioPlayer(maxLabelLength int) *AudioPlayer {
 }
 
 func (g *AudioPlayer) Frequency() uint8 {
+	// The ticker and progress need updating every second, but otherwise the watcher will
+	// let us know about any changes.
+	if g.watch.isRunning() && !g.isAnimating && !g.isProgressing {
+		return 30
+	}
 	return 1
 }
 
-type playingAudioInfo struct {
-	Track  string
-	Artist string
-	Album  string
-	Status string
-}
-
-func (g *AudioPlayer) getInfo() (*playingAudioInfo, error) {
-	rawMetadataOutput, err := runCommand(playerctlExecutable, "metadata")
+func (g *AudioPlayer) Watch(ctx context.Context, notify func()) error {
+	c, err := getMprisClient()
 	if err != nil {
-		// If there's no player open, an error will be thrown by this command
-		// with the below output
-		if string(rawMetadataOutput) == "No players found" {
-			return &playingAudioInfo{
-				Status: playerStatusUnknown,
-			}, nil
-		}
-		return nil, err
+		return err
 	}
 
-	info := new(playingAudioInfo)
+	changes, unsubscribe := c.Subscribe()
+	defer unsubscribe()
 
-	lines := strings.Split(string(rawMetadataOutput), "\n")
-	for _, line := range lines {
-		splitLine := strings.Fields(line)
+	g.watch.set(true)
+	defer g.watch.set(false)
 
-		if len(splitLine) < 3 {
-			continue
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.Done():
+			return errors.New("lost connection to the session bus")
+		case <-changes:
+			notify()
 		}
+	}
+}
 
-		var (
-			// application = splitLine[0]
-			fieldName = splitLine[1]
-			data      = strings.Join(splitLine[2:], " ")
-		)
-
-		switch strings.ToLower(fieldName) {
-		case "xesam:artist":
-			info.Artist = data
-		case "xesam:title":
-			info.Track = data
-		case "xesam:album":
-			info.Album = data
-		}
+// playingAudioInfo is the data available to AudioPlayer formats.
+type playingAudioInfo struct {
+	Player   string
+	Track    string
+	Artist   string
+	Album    string
+	Status   string
+	Position time.Duration
+	Length   time.Duration
+}
+
+// formatTrackTime formats a position in a track as m:ss, or h:mm:ss for
+// particularly long tracks.
+func formatTrackTime(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
 	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
 
-	rawStatusOutput, err := runCommand(playerctlExecutable, "status")
+func (g *AudioPlayer) getPlayer() (*mpris.Client, *mpris.Player, error) {
+	c, err := getMprisClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	player, ok := c.Active(g.PreferredPlayers)
+	if !ok {
+		return c, nil, nil
+	}
+	return c, &player, nil
+}
+
+func (g *AudioPlayer) getInfo() (*playingAudioInfo, error) {
+	_, player, err := g.getPlayer()
 	if err != nil {
 		return nil, err
 	}
 
-	if x := string(rawStatusOutput); !(x == playerStatusStopped || x == playerStatusPlaying || x == playerStatusPaused) {
+	if player == nil {
+		return &playingAudioInfo{
+			Status: playerStatusUnknown,
+		}, nil
+	}
+
+	info := &playingAudioInfo{
+		Player:   player.Name,
+		Track:    player.Metadata.Title,
+		Artist:   strings.Join(player.Metadata.Artists, ", "),
+		Album:    player.Metadata.Album,
+		Status:   player.Status,
+		Position: player.Position(),
+		Length:   player.Metadata.Length,
+	}
+
+	if !(info.Status == playerStatusStopped || info.Status == playerStatusPlaying || info.Status == playerStatusPaused) {
 		info.Status = playerStatusUnknown
-	} else {
-		info.Status = x
 	}
 
 	return info, nil
@@ -109,6 +191,7 @@ func (g *AudioPlayer) AnimateTicker(x string) string {
 		g.lastText = string(asRunes)
 		return string(asRunes)
 	}
+	g.isAnimating = true
 	mod := append(asRunes, []rune("    ")...)
 
 	if sm := string(mod); sm != g.lastText {
@@ -139,19 +222,60 @@ func (g *AudioPlayer) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
 	b := new(i3bar.Block)
 	b.Name = g.name
 
-	b.FullText = musicNoteString
+	text := i3bar.NewPangoText(musicNoteString)
+	g.isAnimating = false
+	g.isProgressing = false
 
 	if info.Status == playerStatusPlaying || (info.Status == playerStatusPaused && g.ShowTextOnPause) {
 
-		b.FullText += " "
+		text.Text(" ")
 
 		if info.Status == playerStatusPaused {
-			b.FullText += pausedIconString + " "
+			text.Colored(colors.Warning, pausedIconString).Text(" ")
+		}
+
+		label, ok, err := g.executeFull(info)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			label = fmt.Sprintf("%s - %s", info.Track, info.Artist)
+			if g.ShowAlbum && info.Album != "" {
+				label += fmt.Sprintf(" (%s)", info.Album)
+			}
+		}
+
+		// Track and artist names are escaped by PangoText, so can contain
+		// characters like & without breaking the markup.
+		text.Text(g.AnimateTicker(label))
+
+		if g.ShowTime {
+			text.Text(" " + formatTrackTime(info.Position))
+			if info.Length > 0 {
+				text.Text("/" + formatTrackTime(info.Length))
+			}
+		}
+
+		if g.ProgressBarWidth > 0 && info.Length > 0 {
+			progress, err := bar(g.ProgressBarWidth, float64(info.Position)/float64(info.Length)*100)
+			if err != nil {
+				return nil, err
+			}
+			text.Text(" ").Colored(colors.Accent, progress)
 		}
 
-		b.FullText += g.AnimateTicker(fmt.Sprintf("%s - %s", info.Track, info.Artist))
+		g.isProgressing = info.Status == playerStatusPlaying && (g.ShowTime || g.ProgressBarWidth > 0)
+	}
+
+	var shortText *i3bar.PangoText
+	if short, ok, err := g.executeShort(info); err != nil {
+		return nil, err
+	} else if ok {
+		shortText = i3bar.NewPangoText(short)
 	}
 
+	b.SetPango(text, shortText)
+
 	return b, nil
 }
 
@@ -159,18 +283,58 @@ func (g *AudioPlayer) GetNameAndInstance() (string, string) {
 	return g.name, ""
 }
 
+func (g *AudioPlayer) sendCommand(command func(c *mpris.Client, busName string) error) error {
+	c, player, err := g.getPlayer()
+	if err != nil {
+		return err
+	}
+	if player == nil {
+		return nil
+	}
+	return command(c, player.BusName)
+}
+
+// seekTo moves the current track to the position proportional to where the
+// block was clicked, so that clicking halfway along the block seeks halfway
+// through the track.
+func (g *AudioPlayer) seekTo(event *i3bar.ClickEvent) error {
+	c, player, err := g.getPlayer()
+	if err != nil {
+		return err
+	}
+	if player == nil || !player.CanSeek || player.Metadata.Length <= 0 || event.Width <= 0 {
+		return nil
+	}
+	fraction := float64(event.RelativeX) / float64(event.Width)
+	position := time.Duration(fraction * float64(player.Metadata.Length))
+	if player.Metadata.TrackID == "" {
+		// SetPosition needs the current track ID, so players that don't
+		// report one can only seek relative to where they are.
+		return c.Seek(player.BusName, position-player.Position())
+	}
+	return c.SetPosition(player.BusName, player.Metadata.TrackID, position)
+}
+
 func (g *AudioPlayer) OnClick(event *i3bar.ClickEvent) bool {
+	var err error
+
 	switch event.Button {
 	case i3bar.LeftMouseButton:
-		_, _ = runCommand(playerctlExecutable, "play-pause")
+		err = g.sendCommand((*mpris.Client).PlayPause)
+	case i3bar.RightMouseButton:
+		err = g.seekTo(event)
 	case i3bar.MouseWheelScrollUp:
-		_, _ = runCommand(playerctlExecutable, "next")
+		err = g.sendCommand((*mpris.Client).Next)
 	case i3bar.MouseWheelScrollDown:
-		_, _ = runCommand(playerctlExecutable, "previous")
+		err = g.sendCommand((*mpris.Client).Previous)
 	default:
 		return false
 	}
-	
+
+	if err != nil {
+		log.Error().Err(err).Str("location", "audioPlayer_OnClick").Send()
+	}
+
 	time.Sleep(time.Millisecond * 50)
 	return true
 }
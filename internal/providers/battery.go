@@ -1,13 +1,18 @@
 package providers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"math"
 	"path"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
 )
 
 const (
@@ -18,16 +23,34 @@ const (
 )
 
 type Battery struct {
-	FullThreshold    float32
-	OkThreshold      float32
-	WarningThreshold float32
-
-	DeviceName         string
-	UseDesignMaxEnergy bool
+	FullThreshold    float32 `toml:"full_threshold"`
+	OkThreshold      float32 `toml:"ok_threshold"`
+	WarningThreshold float32 `toml:"warning_threshold"`
+
+	DeviceName string `toml:"device"`
+	// Devices, if set, is a list of batteries that are combined into one
+	// block, for laptops with more than one battery. It takes precedence
+	// over DeviceName.
+	Devices            []string `toml:"devices"`
+	UseDesignMaxEnergy bool     `toml:"use_design_max_energy"`
+	// AverageWindow is the number of seconds that the power draw is averaged
+	// over when estimating the time remaining. Zero disables the estimate.
+	AverageWindow int `toml:"average_window"`
+	TextFormat
+	ThresholdAlert
 
 	name                         string
 	previousWasBackgroundWarning bool
 	isAlert                      bool
+	watch                        watchState
+
+	powerSamples []powerSample
+	sampleState  string
+}
+
+type powerSample struct {
+	time  time.Time
+	power float64
 }
 
 func NewBattery(deviceName string, fullThreshold, okThreshold, warningThreshold float32) i3bar.BlockGenerator {
@@ -36,6 +59,8 @@ func NewBattery(deviceName string, fullThreshold, okThreshold, warningThreshold
 		FullThreshold:    fullThreshold,
 		OkThreshold:      okThreshold,
 		WarningThreshold: warningThreshold,
+		AverageWindow:    120,
+		ThresholdAlert:   newThresholdAlert(2),
 		name:             "battery",
 	}
 }
@@ -47,49 +72,160 @@ func (g *Battery) Frequency() uint8 {
 	return 5
 }
 
-func (g *Battery) infoPath() string {
-	return path.Join("/sys/class/power_supply", g.DeviceName)
+// Watch refreshes the block as soon as a battery or AC adapter changes state,
+// such as when the charger is plugged in. The kernel doesn't send an event
+// for every change in charge, so the block is still polled.
+func (g *Battery) Watch(ctx context.Context, notify func()) error {
+	return watchUevents(ctx, &g.watch, notify, "power_supply")
 }
 
-func (g *Battery) getPercentage() (float32, error) {
-	// TODO: Cache the read of energy_full
-	var maxEnergy, energyNow int32
-	{
-		maxFile := "energy_full"
-		if g.UseDesignMaxEnergy {
-			maxFile = "energy_full_design"
-		}
+func (g *Battery) devices() []string {
+	if len(g.Devices) != 0 {
+		return g.Devices
+	}
+	return []string{g.DeviceName}
+}
 
-		me, err := ioutil.ReadFile(path.Join(g.infoPath(), maxFile))
-		if err != nil {
-			return 0, err
-		}
+func (g *Battery) instance() string {
+	return strings.Join(g.devices(), "+")
+}
 
-		en, err := ioutil.ReadFile(path.Join(g.infoPath(), "energy_now"))
+func batteryInfoPath(device string) string {
+	return path.Join("/sys/class/power_supply", device)
+}
+
+// batteryReading is the state of one battery. Energies are in µWh and power is
+// in µW.
+type batteryReading struct {
+	energyNow  float64
+	energyFull float64
+	power      float64
+	state      string
+}
+
+// readBattery reads the state of a battery from sysfs. Batteries report either
+// energy (energy_* and power_now) or charge (charge_* and current_now), and
+// charge is converted to energy using the battery's voltage so that both kinds
+// can be combined.
+func (g *Battery) readBattery(device string) (*batteryReading, error) {
+	infoPath := batteryInfoPath(device)
+	read := func(name string) (float64, error) {
+		x, err := readSysfsInt(path.Join(infoPath, name))
+		return float64(x), err
+	}
+
+	fullSuffix := "full"
+	if g.UseDesignMaxEnergy {
+		fullSuffix = "full_design"
+	}
+
+	reading := new(batteryReading)
+
+	var err error
+	if reading.energyNow, err = read("energy_now"); err == nil {
+		if reading.energyFull, err = read("energy_" + fullSuffix); err != nil {
+			return nil, err
+		}
+		// power_now isn't provided by every battery, in which case the
+		// time remaining can't be estimated.
+		reading.power, _ = read("power_now")
+	} else if errors.Is(err, fs.ErrNotExist) {
+		chargeNow, err := read("charge_now")
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-
-		mei, err := strconv.ParseInt(strings.TrimSpace(string(me)), 10, 32)
+		chargeFull, err := read("charge_" + fullSuffix)
 		if err != nil {
-			return 0, err
+			return nil, err
+		}
+		current, _ := read("current_now")
+
+		// Voltages are in µV. If the voltage isn't known, the charge is used
+		// as-is, which is still correct as long as all batteries are the
+		// same kind.
+		voltage, err := read("voltage_now")
+		if err != nil || voltage == 0 {
+			voltage, err = read("voltage_min_design")
+		}
+		scale := 1.0
+		if err == nil && voltage != 0 {
+			scale = voltage / 1e6
 		}
 
-		eni, err := strconv.ParseInt(strings.TrimSpace(string(en)), 10, 32)
-		if err != nil {
-			return 0, err
+		reading.energyNow = chargeNow * scale
+		reading.energyFull = chargeFull * scale
+		reading.power = current * scale
+	} else {
+		return nil, err
+	}
+
+	// Some batteries report negative power or current while discharging.
+	reading.power = math.Abs(reading.power)
+
+	if reading.state, err = getBatteryState(device); err != nil {
+		return nil, err
+	}
+
+	return reading, nil
+}
+
+// combineBatteryStates returns the overall state of several batteries. If any
+// battery is charging or discharging then so is the whole system.
+func combineBatteryStates(states []string) string {
+	for _, want := range []string{batteryStateCharging, batteryStateDischarging} {
+		for _, state := range states {
+			if state == want {
+				return want
+			}
 		}
+	}
+	for _, state := range states {
+		if state != batteryStateFull {
+			return batteryStateUnknown
+		}
+	}
+	return batteryStateFull
+}
+
+// averagePower records a new power sample and returns the mean power over the
+// last AverageWindow seconds. Samples are discarded if the battery changes
+// between charging and discharging.
+func (g *Battery) averagePower(state string, power float64) float64 {
+	now := time.Now()
 
-		maxEnergy = int32(mei)
-		energyNow = int32(eni)
+	if state != g.sampleState {
+		g.powerSamples = nil
+		g.sampleState = state
 	}
 
-	return (float32(energyNow) / float32(maxEnergy)) * 100, nil
+	if power > 0 {
+		g.powerSamples = append(g.powerSamples, powerSample{time: now, power: power})
+	}
+
+	cutoff := now.Add(-time.Duration(g.AverageWindow) * time.Second)
+	for len(g.powerSamples) > 0 && g.powerSamples[0].time.Before(cutoff) {
+		g.powerSamples = g.powerSamples[1:]
+	}
+
+	if len(g.powerSamples) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, sample := range g.powerSamples {
+		sum += sample.power
+	}
+	return sum / float64(len(g.powerSamples))
 }
 
-func (g *Battery) getState() (string, error) {
+// formatBatteryTime formats a duration as h:mm.
+func formatBatteryTime(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
 
-	sa, err := ioutil.ReadFile(path.Join(g.infoPath(), "status"))
+func getBatteryState(device string) (string, error) {
+	sa, err := ioutil.ReadFile(path.Join(batteryInfoPath(device), "status"))
 	if err != nil {
 		return "", err
 	}
@@ -112,24 +248,89 @@ func (g *Battery) getState() (string, error) {
 	return x, nil
 }
 
-func (g *Battery) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
-	percentage, err := g.getPercentage()
-	if err != nil {
-		return nil, err
+// batteryData is the data available to Battery formats.
+type batteryData struct {
+	// DeviceName is the name of the battery, or the names of all batteries
+	// joined with "+" if there's more than one.
+	DeviceName string
+	Percent    float32
+	// State is one of "FULL", "BAT", "CHR" or "UNK".
+	State string
+	// Power is the average power draw in watts, or the current power draw if
+	// AverageWindow is zero.
+	Power float64
+	// Remaining is the estimated time until the battery is empty when
+	// discharging, or full when charging. It is zero if it isn't known.
+	Remaining time.Duration
+}
+
+func (g *Battery) getData() (*batteryData, error) {
+	var (
+		energyNow, energyFull, power float64
+		states                       []string
+	)
+
+	for _, device := range g.devices() {
+		reading, err := g.readBattery(device)
+		if err != nil {
+			return nil, err
+		}
+		energyNow += reading.energyNow
+		energyFull += reading.energyFull
+		power += reading.power
+		states = append(states, reading.state)
+	}
+
+	data := &batteryData{
+		DeviceName: g.instance(),
+		State:      combineBatteryStates(states),
+	}
+
+	if energyFull != 0 {
+		data.Percent = float32(energyNow / energyFull * 100)
 	}
 
-	state, err := g.getState()
+	if g.AverageWindow <= 0 {
+		data.Power = power / 1e6
+		return data, nil
+	}
+
+	power = g.averagePower(data.State, power)
+	data.Power = power / 1e6
+
+	if power > 0 {
+		var hours float64
+		switch data.State {
+		case batteryStateDischarging:
+			hours = energyNow / power
+		case batteryStateCharging:
+			hours = (energyFull - energyNow) / power
+		}
+		data.Remaining = time.Duration(hours * float64(time.Hour))
+	}
+
+	return data, nil
+}
+
+func (g *Battery) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	data, err := g.getData()
 	if err != nil {
 		return nil, err
 	}
 
+	percentage, state := data.Percent, data.State
+
 	block := &i3bar.Block{
 		Name:      g.name,
-		Instance:  g.DeviceName,
+		Instance:  data.DeviceName,
 		FullText:  fmt.Sprintf("%s %.1f%%", state, percentage),
 		ShortText: fmt.Sprintf("%.1f%%", percentage),
 	}
 
+	if data.Remaining > 0 {
+		block.FullText += fmt.Sprintf(" (%s)", formatBatteryTime(data.Remaining))
+	}
+
 	if percentage < g.WarningThreshold && g.WarningThreshold != 0 {
 
 		g.isAlert = true
@@ -164,9 +365,27 @@ func (g *Battery) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
 		block.TextColor = colors.Warning
 	}
 
+	if state == batteryStateDischarging {
+		body := fmt.Sprintf("%s is at %.1f%%", data.DeviceName, percentage)
+		if data.Remaining > 0 {
+			body += fmt.Sprintf(" (%s remaining)", formatBatteryTime(data.Remaining))
+		}
+		g.ThresholdAlert.check(g.name+data.DeviceName, float64(percentage), notify.Thresholds{
+			Warning:      float64(g.OkThreshold),
+			Bad:          float64(g.WarningThreshold),
+			LowerIsWorse: true,
+		}, "Low battery", body)
+	} else {
+		g.ThresholdAlert.reset()
+	}
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
 	return block, nil
 }
 
 func (g *Battery) GetNameAndInstance() (string, string) {
-	return g.name, g.DeviceName
+	return g.name, g.instance()
 }
@@ -8,81 +8,303 @@ import (
 	"strings"
 
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
 )
 
 type CPU struct {
-	OkThreshold      float32
-	WarningThreshold float32
+	OkThreshold      float32 `toml:"ok_threshold"`
+	WarningThreshold float32 `toml:"warning_threshold"`
+	// PerCore shows the usage of each core as well as the total.
+	PerCore bool `toml:"per_core"`
+	// HistoryLength is the number of samples shown in a sparkline of
+	// recent usage. Zero disables the sparkline.
+	HistoryLength int `toml:"history_length"`
+	// ShowIOWait shows the percentage of time spent waiting for IO and, on
+	// virtual machines, stolen by the hypervisor.
+	ShowIOWait bool `toml:"show_iowait"`
+	// ShowLoad shows the 1, 5 and 15 minute load averages.
+	ShowLoad bool `toml:"show_load"`
+	TextFormat
+	ThresholdAlert
 
-	idle0, total0 uint64
-	idle1, total1 uint64
+	previous, current cpuSample
+	history           []float32
 
 	name string
 }
 
 func NewCPU(okThreshold, warningThreshold float32) i3bar.BlockGenerator {
-	m := &CPU{
+	return &CPU{
 		OkThreshold:      okThreshold,
 		WarningThreshold: warningThreshold,
-		name: "cpu",
+		ThresholdAlert:   newThresholdAlert(5),
+		name:             "cpu",
 	}
-	_ = m.doSample()
-	return m
 }
 
 func (g *CPU) Frequency() uint8 {
 	return 2
 }
 
+// cpuTimes is the time spent by a CPU in each state, in ticks, as listed in
+// /proc/stat.
+type cpuTimes struct {
+	user, nice, system, idle, iowait, irq, softirq, steal uint64
+}
+
+// total returns the total number of ticks. Time spent running guests is
+// already included in user and nice, so isn't counted again.
+func (t cpuTimes) total() uint64 {
+	return t.user + t.nice + t.system + t.idle + t.iowait + t.irq + t.softirq + t.steal
+}
+
+func parseCPUTimes(fields []string) (cpuTimes, error) {
+	var values [8]uint64
+	// Older kernels don't report every field, in which case the rest are
+	// left as zero.
+	for i := 0; i < len(values) && i < len(fields); i++ {
+		val, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return cpuTimes{}, err
+		}
+		values[i] = val
+	}
+	return cpuTimes{
+		user:    values[0],
+		nice:    values[1],
+		system:  values[2],
+		idle:    values[3],
+		iowait:  values[4],
+		irq:     values[5],
+		softirq: values[6],
+		steal:   values[7],
+	}, nil
+}
+
+// cpuCoreTimes is the times of a single core, identified by the number in its
+// "cpuN" line.
+type cpuCoreTimes struct {
+	id    int
+	times cpuTimes
+}
+
+// cpuSample is a reading of the total CPU times and the times of each online
+// core.
+type cpuSample struct {
+	total cpuTimes
+	cores []cpuCoreTimes
+}
+
 func (g *CPU) doSample() error {
 	contents, err := ioutil.ReadFile("/proc/stat")
 	if err != nil {
 		return err
 	}
 
-	g.idle0 = g.idle1
-	g.total0 = g.total1
-
-	g.idle1 = 0
-	g.total1 = 0
+	var (
+		sample   cpuSample
+		foundCPU bool
+	)
 
-	lines := strings.Split(string(contents), "\n")
-	for _, line := range lines {
+	for _, line := range strings.Split(string(contents), "\n") {
 		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		times, err := parseCPUTimes(fields[1:])
+		if err != nil {
+			return err
+		}
+
 		if fields[0] == "cpu" {
-			numFields := len(fields)
-			for i := 1; i < numFields; i++ {
-				val, err := strconv.ParseUint(fields[i], 10, 64)
-				if err != nil {
-					return err
-				}
-				g.total1 += val // tally up all the numbers to get total ticks
-				if i == 4 {     // idle is the 5th field in the cpu line
-					g.idle1 = val
-				}
-			}
-			return nil
+			sample.total = times
+			foundCPU = true
+			continue
 		}
+
+		// Offline cores aren't listed, so the position of a core in the
+		// file isn't its number.
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu"))
+		if err != nil {
+			return fmt.Errorf("unexpected CPU name %q", fields[0])
+		}
+		sample.cores = append(sample.cores, cpuCoreTimes{id: id, times: times})
 	}
 
-	return errors.New("no CPU field")
+	if !foundCPU {
+		return errors.New("no CPU field")
+	}
+
+	g.previous = g.current
+	g.current = sample
+	return nil
 }
 
-func (g *CPU) getPercentage() float32 {
-	idleTicks := float64(g.idle1 - g.idle0)
-	totalTicks := float64(g.total1 - g.total0)
-	return float32(100 * (totalTicks - idleTicks) / totalTicks)
+// cpuUsage is the percentage of time spent in each state between two samples.
+type cpuUsage struct {
+	busy, iowait, steal float32
 }
 
-func (g *CPU) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+// since returns the ticks spent in each state since previous. The kernel
+// doesn't guarantee that counters only increase, and iowait in particular can
+// go backwards, so a counter that has decreased is treated as unchanged.
+func (t cpuTimes) since(previous cpuTimes) cpuTimes {
+	return cpuTimes{
+		user:    counterDelta(previous.user, t.user),
+		nice:    counterDelta(previous.nice, t.nice),
+		system:  counterDelta(previous.system, t.system),
+		idle:    counterDelta(previous.idle, t.idle),
+		iowait:  counterDelta(previous.iowait, t.iowait),
+		irq:     counterDelta(previous.irq, t.irq),
+		softirq: counterDelta(previous.softirq, t.softirq),
+		steal:   counterDelta(previous.steal, t.steal),
+	}
+}
+
+func usageBetween(previous, current cpuTimes) cpuUsage {
+	delta := current.since(previous)
+	totalTicks := float32(delta.total())
+	if totalTicks == 0 {
+		return cpuUsage{}
+	}
+	percent := func(ticks uint64) float32 {
+		return 100 * float32(ticks) / totalTicks
+	}
+	return cpuUsage{
+		// Only idle time isn't busy. Time spent waiting for IO is counted
+		// as busy, and is also reported separately.
+		busy:   100 - percent(delta.idle),
+		iowait: percent(delta.iowait),
+		steal:  percent(delta.steal),
+	}
+}
+
+// coreUsage returns the busy percentage of each core between the last two
+// samples.
+func (g *CPU) coreUsage() []float32 {
+	previousCores := make(map[int]cpuTimes, len(g.previous.cores))
+	for _, core := range g.previous.cores {
+		previousCores[core.id] = core.times
+	}
+
+	var usages []float32
+	for _, core := range g.current.cores {
+		var usage cpuUsage
+		// Cores can come online between samples, in which case they have
+		// no previous reading. The first sample is compared with the times
+		// at boot, like the total.
+		if previous, found := previousCores[core.id]; found || g.previous.cores == nil {
+			usage = usageBetween(previous, core.times)
+		}
+		usages = append(usages, usage.busy)
+	}
+	return usages
+}
+
+// getLoadAverages returns the 1, 5 and 15 minute load averages.
+func getLoadAverages() (loads [3]float64, err error) {
+	contents, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return loads, err
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) < 3 {
+		return loads, errors.New("unexpected /proc/loadavg format")
+	}
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return loads, err
+		}
+	}
+	return loads, nil
+}
+
+// cpuData is the data available to CPU formats. All values are percentages
+// unless otherwise stated.
+type cpuData struct {
+	// Percent is the percentage of time that wasn't idle, including time
+	// spent waiting for IO.
+	Percent float32
+	// Cores is the usage of each online core, in order.
+	Cores  []float32
+	IOWait float32
+	Steal  float32
+	// History is the usage from recent samples, oldest first, and has up to
+	// HistoryLength items.
+	History []float32
+	// Load1, Load5 and Load15 are the load averages over the last 1, 5 and
+	// 15 minutes.
+	Load1, Load5, Load15 float64
+}
+
+func (g *CPU) getData() (*cpuData, error) {
 	if err := g.doSample(); err != nil {
 		return nil, err
 	}
-	p := g.getPercentage()
+
+	// There's nothing to compare the first sample with, so it shows the
+	// average usage since boot.
+	usage := usageBetween(g.previous.total, g.current.total)
+	data := &cpuData{
+		Percent: usage.busy,
+		IOWait:  usage.iowait,
+		Steal:   usage.steal,
+	}
+
+	data.Cores = g.coreUsage()
+
+	if g.HistoryLength > 0 {
+		g.history = append(g.history, data.Percent)
+		if len(g.history) > g.HistoryLength {
+			g.history = g.history[len(g.history)-g.HistoryLength:]
+		}
+		data.History = g.history
+	}
+
+	loads, err := getLoadAverages()
+	if err != nil {
+		return nil, err
+	}
+	data.Load1, data.Load5, data.Load15 = loads[0], loads[1], loads[2]
+
+	return data, nil
+}
+
+func (g *CPU) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	data, err := g.getData()
+	if err != nil {
+		return nil, err
+	}
+
+	p := data.Percent
+
+	fullText := new(strings.Builder)
+	fmt.Fprintf(fullText, "CPU: %.1f%%", p)
+
+	if g.PerCore && len(data.Cores) != 0 {
+		cores := make([]string, len(data.Cores))
+		for i, core := range data.Cores {
+			cores[i] = fmt.Sprintf("%.0f", core)
+		}
+		fmt.Fprintf(fullText, " (%s)", strings.Join(cores, " "))
+	}
+
+	if g.ShowIOWait {
+		fmt.Fprintf(fullText, " io:%.1f%% st:%.1f%%", data.IOWait, data.Steal)
+	}
+
+	if g.HistoryLength > 0 {
+		fullText.WriteString(" " + sparkline(data.History, 100))
+	}
+
+	if g.ShowLoad {
+		fmt.Fprintf(fullText, " %.2f %.2f %.2f", data.Load1, data.Load5, data.Load15)
+	}
 
 	block := &i3bar.Block{
 		Name:      g.name,
-		FullText:  fmt.Sprintf("CPU: %.1f%%", p),
+		FullText:  fullText.String(),
 		ShortText: fmt.Sprintf("C: %.1f%%", p),
 	}
 
@@ -92,9 +314,18 @@ func (g *CPU) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
 		block.TextColor = colors.Warning
 	}
 
+	g.ThresholdAlert.check(g.name, float64(p), notify.Thresholds{
+		Warning: float64(g.OkThreshold),
+		Bad:     float64(g.WarningThreshold),
+	}, "High CPU usage", fmt.Sprintf("CPU usage is %.1f%%", p))
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
 	return block, nil
 }
 
 func (g *CPU) GetNameAndInstance() (string, string) {
 	return g.name, ""
-}
\ No newline at end of file
+}
@@ -0,0 +1,86 @@
+package providers
+
+import "testing"
+
+func TestUsageBetween(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current cpuTimes
+		want              cpuUsage
+	}{
+		{
+			name:     "iowait counts as busy",
+			previous: cpuTimes{user: 100, idle: 100, iowait: 100},
+			current:  cpuTimes{user: 150, idle: 125, iowait: 125},
+			want:     cpuUsage{busy: 75, iowait: 25},
+		},
+		{
+			name:     "iowait goes backwards",
+			previous: cpuTimes{user: 100, idle: 100, iowait: 100},
+			current:  cpuTimes{user: 150, idle: 150, iowait: 90},
+			want:     cpuUsage{busy: 50},
+		},
+		{
+			name:     "steal",
+			previous: cpuTimes{},
+			current:  cpuTimes{system: 10, idle: 80, steal: 10},
+			want:     cpuUsage{busy: 20, steal: 10},
+		},
+		{
+			name:     "no ticks",
+			previous: cpuTimes{user: 100, idle: 100},
+			current:  cpuTimes{user: 100, idle: 100},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := usageBetween(test.previous, test.current); got != test.want {
+				t.Errorf("usageBetween() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCPUCoreUsage(t *testing.T) {
+	g := &CPU{
+		// cpu1 was offline for the previous sample.
+		previous: cpuSample{cores: []cpuCoreTimes{
+			{id: 0, times: cpuTimes{user: 100, idle: 100}},
+			{id: 2, times: cpuTimes{user: 100, idle: 100}},
+		}},
+		current: cpuSample{cores: []cpuCoreTimes{
+			{id: 0, times: cpuTimes{user: 150, idle: 150}},
+			{id: 1, times: cpuTimes{user: 10, idle: 10}},
+			{id: 2, times: cpuTimes{user: 200, idle: 100}},
+		}},
+	}
+
+	want := []float32{50, 0, 100}
+	got := g.coreUsage()
+	if len(got) != len(want) {
+		t.Fatalf("coreUsage() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("coreUsage() = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestCPUFirstSampleCoreUsage(t *testing.T) {
+	// Without a previous sample, usage is the average since boot.
+	g := &CPU{
+		current: cpuSample{cores: []cpuCoreTimes{
+			{id: 0, times: cpuTimes{user: 150, idle: 150}},
+			{id: 1, times: cpuTimes{user: 100, idle: 300}},
+		}},
+	}
+
+	want := []float32{50, 25}
+	got := g.coreUsage()
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("coreUsage() = %v, want %v", got, want)
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 type DateTime struct {
 	// TODO: 12 hour mode?
+	TextFormat
+
 	name string
 }
 
@@ -21,14 +23,29 @@ func (g *DateTime) Frequency() uint8 {
 	return 1
 }
 
+func (g *DateTime) Schedule() i3bar.Schedule {
+	return i3bar.Schedule{Interval: time.Second, Align: true}
+}
+
+// dateTimeData is the data available to DateTime formats.
+type dateTimeData struct {
+	Time time.Time
+}
+
 func (g *DateTime) Block(*i3bar.ColorSet) (*i3bar.Block, error) {
 	cTime := time.Now().Local()
 
-	return &i3bar.Block{
+	block := &i3bar.Block{
 		Name:      g.name,
 		FullText:  cTime.Weekday().String()[:2] + cTime.Format(" 2006-01-02 15:04:05"),
 		ShortText: cTime.Format("15:04:05"),
-	}, nil
+	}
+
+	if err := g.TextFormat.apply(block, &dateTimeData{Time: cTime}); err != nil {
+		return nil, err
+	}
+
+	return block, nil
 }
 
 func (g *DateTime) GetNameAndInstance() (string, string) {
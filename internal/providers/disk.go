@@ -1,19 +1,53 @@
 package providers
 
 import (
-	"errors"
 	"fmt"
+	"io/ioutil"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
+	"golang.org/x/sys/unix"
+)
+
+// Modes for Disk.
+const (
+	diskModeFree    = "free"
+	diskModeUsed    = "used"
+	diskModeTotal   = "total"
+	diskModePercent = "percent"
 )
 
 type Disk struct {
-	OkThreshold      float32
-	WarningThreshold float32
+	// OkThreshold and WarningThreshold are compared with the free space of
+	// each mount, in GB or GiB depending on Binary. If PercentThresholds is
+	// set, they are a percentage of the size of the mount instead.
+	OkThreshold       float32 `toml:"ok_threshold"`
+	WarningThreshold  float32 `toml:"warning_threshold"`
+	PercentThresholds bool    `toml:"percent_thresholds"`
 
-	MountPath string
+	MountPath string `toml:"mount_path"`
+	// MountPaths shows several mounts in one block, and takes precedence
+	// over MountPath. The block's colour and alerts are based on the mount
+	// with the least free space, so mounts that should be coloured and
+	// alerted on separately need a block each.
+	MountPaths []string `toml:"mount_paths"`
+	// Mode is one of "free", "used", "total" (used and total) or "percent"
+	// (percentage used).
+	Mode string `toml:"mode"`
+	// Binary uses binary units, such as GiB, instead of decimal units, such
+	// as GB.
+	Binary bool `toml:"binary"`
+	// ShowIO shows the rate that the disks behind the mounts are being read
+	// from and written to.
+	ShowIO bool `toml:"show_io"`
+	TextFormat
+	ThresholdAlert
+
+	previousIO, currentIO diskIOSample
 
 	name string
 }
@@ -23,51 +57,317 @@ func NewDisk(mountPath string, okThreshold, warningThreshold float32) i3bar.Bloc
 		OkThreshold:      okThreshold,
 		WarningThreshold: warningThreshold,
 		MountPath:        mountPath,
+		Mode:             diskModeFree,
+		ThresholdAlert:   newThresholdAlert(0.5),
 		name:             "disk",
 	}
 }
 
+func (g *Disk) validate() error {
+	switch g.Mode {
+	case diskModeFree, diskModeUsed, diskModeTotal, diskModePercent:
+	default:
+		return fmt.Errorf("unknown mode %q, must be one of %q, %q, %q or %q", g.Mode, diskModeFree, diskModeUsed, diskModeTotal, diskModePercent)
+	}
+	return g.TextFormat.validate()
+}
+
 func (g *Disk) Frequency() uint8 {
 	return 5
 }
 
-func (g *Disk) getAvailable() (float32, error) {
-	cmdout, err := runCommand("df", "-x", "fuse.portal")
-	if err != nil {
-		return 0, err
+func (g *Disk) mountPaths() []string {
+	if len(g.MountPaths) != 0 {
+		return g.MountPaths
+	}
+	if g.MountPath == "" {
+		return []string{"/"}
+	}
+	return []string{g.MountPath}
+}
+
+// diskUsage is the size of a filesystem in bytes.
+type diskUsage struct {
+	free, used, total uint64
+	// device is the device number of the filesystem.
+	device uint64
+}
+
+func getDiskUsage(mountPath string) (*diskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPath, &stat); err != nil {
+		return nil, fmt.Errorf("could not read usage of %s: %w", mountPath, err)
 	}
-	for _, line := range strings.Split(string(cmdout), "\n") {
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(mountPath, &st); err != nil {
+		return nil, fmt.Errorf("could not read usage of %s: %w", mountPath, err)
+	}
+
+	blockSize := uint64(stat.Bsize)
+	return &diskUsage{
+		// Blocks reserved for root aren't available to anyone else, so
+		// aren't counted as free.
+		free:   stat.Bavail * blockSize,
+		used:   (stat.Blocks - stat.Bfree) * blockSize,
+		total:  stat.Blocks * blockSize,
+		device: uint64(st.Dev),
+	}, nil
+}
+
+// percentUsed returns the percentage of the space available to users that is
+// used, which is the same as df reports.
+func (u *diskUsage) percentUsed() float32 {
+	if u.used+u.free == 0 {
+		return 0
+	}
+	return float32(u.used) / float32(u.used+u.free) * 100
+}
+
+// diskIOCounters is the number of bytes read from and written to a block
+// device, as listed in /proc/diskstats.
+type diskIOCounters struct {
+	read, written uint64
+}
+
+// diskIOSample is a reading of the counters of every block device, keyed by
+// device number.
+type diskIOSample struct {
+	time    time.Time
+	devices map[uint64]diskIOCounters
+}
+
+// parseDiskstats parses the contents of /proc/diskstats.
+func parseDiskstats(contents string) (map[uint64]diskIOCounters, error) {
+	// Sectors are always 512 bytes here, regardless of the device.
+	const sectorSize = 512
+
+	devices := make(map[uint64]diskIOCounters)
+	for _, line := range strings.Split(contents, "\n") {
 		fields := strings.Fields(line)
-		if fields[5] == g.MountPath || (g.MountPath == "" && fields[5] == "/") {
-			y, _ := strconv.ParseFloat(fields[3], 64)
-			return float32(y / 1000 / 1000), nil // to GB
+		if len(fields) < 10 {
+			continue
+		}
+
+		var values [4]uint64
+		for i, field := range []string{fields[0], fields[1], fields[5], fields[9]} {
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = val
+		}
+
+		device := unix.Mkdev(uint32(values[0]), uint32(values[1]))
+		devices[device] = diskIOCounters{
+			read:    values[2] * sectorSize,
+			written: values[3] * sectorSize,
+		}
+	}
+	return devices, nil
+}
+
+func (g *Disk) doIOSample() error {
+	contents, err := ioutil.ReadFile("/proc/diskstats")
+	if err != nil {
+		return err
+	}
+
+	devices, err := parseDiskstats(string(contents))
+	if err != nil {
+		return err
+	}
+
+	g.previousIO = g.currentIO
+	g.currentIO = diskIOSample{time: time.Now(), devices: devices}
+	return nil
+}
+
+// ioRates returns the read and write rates of a device in bytes per second.
+// ok is false if the device doesn't appear in /proc/diskstats, which is the
+// case for network filesystems, tmpfs and btrfs, or if there is no previous
+// sample.
+func (g *Disk) ioRates(device uint64) (read, write float64, ok bool) {
+	previous, found := g.previousIO.devices[device]
+	if !found {
+		return 0, 0, false
+	}
+	current, found := g.currentIO.devices[device]
+	if !found {
+		return 0, 0, false
+	}
+	seconds := g.currentIO.time.Sub(g.previousIO.time).Seconds()
+	if seconds <= 0 {
+		return 0, 0, false
+	}
+	return float64(counterDelta(previous.read, current.read)) / seconds,
+		float64(counterDelta(previous.written, current.written)) / seconds,
+		true
+}
+
+// diskMountData describes a single mount. Sizes are in GB, or GiB if binary
+// units are used.
+type diskMountData struct {
+	MountPath string
+	Available float32
+	Used      float32
+	Total     float32
+	// Percent is the percentage of the space that is used.
+	Percent float32
+	// ReadRate and WriteRate are in bytes per second, and are zero unless
+	// ShowIO is set.
+	ReadRate  float64
+	WriteRate float64
+}
+
+// diskData is the data available to Disk formats. The fields outside of
+// Mounts describe the first mount, except for ReadRate and WriteRate, which
+// are the total for every mount.
+type diskData struct {
+	diskMountData
+	Mounts []diskMountData
+	// Unit is "GB" or "GiB".
+	Unit string
+}
+
+// thresholdValue returns the value of a mount that is compared with the
+// thresholds.
+func (g *Disk) thresholdValue(mount *diskMountData) float32 {
+	if g.PercentThresholds {
+		return 100 - mount.Percent
+	}
+	return mount.Available
+}
+
+// formatMount returns the size of a mount as described by Mode.
+func (g *Disk) formatMount(mount *diskMountData, unit string) string {
+	switch g.Mode {
+	case diskModeUsed:
+		return fmt.Sprintf("%.1f%s", mount.Used, unit)
+	case diskModeTotal:
+		return fmt.Sprintf("%.1f/%.1f%s", mount.Used, mount.Total, unit)
+	case diskModePercent:
+		return fmt.Sprintf("%.0f%%", mount.Percent)
+	}
+	return fmt.Sprintf("%.1f%s", mount.Available, unit)
+}
+
+func (g *Disk) getData() (*diskData, error) {
+	unit, divisor := gigabyteUnit(g.Binary)
+
+	if g.ShowIO {
+		if err := g.doIOSample(); err != nil {
+			return nil, err
 		}
 	}
-	return 0, errors.New("could not find specified mounted drive")
+
+	data := &diskData{Unit: unit}
+	var (
+		readRate, writeRate float64
+		// The same device can be mounted more than once, and shouldn't be
+		// counted twice in the total IO rates.
+		countedDevices = make(map[uint64]bool)
+	)
+
+	for _, path := range g.mountPaths() {
+		usage, err := getDiskUsage(path)
+		if err != nil {
+			return nil, err
+		}
+
+		mount := diskMountData{
+			MountPath: path,
+			Available: float32(usage.free) / divisor,
+			Used:      float32(usage.used) / divisor,
+			Total:     float32(usage.total) / divisor,
+			Percent:   usage.percentUsed(),
+		}
+
+		if g.ShowIO {
+			if read, write, ok := g.ioRates(usage.device); ok {
+				mount.ReadRate, mount.WriteRate = read, write
+				if !countedDevices[usage.device] {
+					readRate += read
+					writeRate += write
+					countedDevices[usage.device] = true
+				}
+			}
+		}
+
+		data.Mounts = append(data.Mounts, mount)
+	}
+
+	data.diskMountData = data.Mounts[0]
+	data.ReadRate, data.WriteRate = readRate, writeRate
+
+	return data, nil
 }
 
 func (g *Disk) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
-	da, err := g.getAvailable()
+	data, err := g.getData()
 	if err != nil {
 		return nil, err
 	}
 
+	var (
+		full, short []string
+		// worst is the mount with the least free space.
+		worst = &data.Mounts[0]
+	)
+	for i := range data.Mounts {
+		mount := &data.Mounts[i]
+		text := g.formatMount(mount, data.Unit)
+		if len(data.Mounts) == 1 {
+			full = append(full, text)
+		} else {
+			full = append(full, mount.MountPath+" "+text)
+		}
+		short = append(short, text)
+
+		if g.thresholdValue(mount) < g.thresholdValue(worst) {
+			worst = mount
+		}
+	}
+
 	block := &i3bar.Block{
 		Name:      g.name,
-		Instance:  g.MountPath,
-		FullText:  fmt.Sprintf("Disk: %.1fGB", da),
-		ShortText: fmt.Sprintf("D: %.1fGB", da),
+		Instance:  g.instance(),
+		FullText:  "Disk: " + strings.Join(full, " "),
+		ShortText: "D: " + strings.Join(short, " "),
 	}
 
-	if da < g.WarningThreshold && g.WarningThreshold != 0 {
+	if g.ShowIO {
+		block.FullText += fmt.Sprintf(" r:%s/s w:%s/s", formatBytes(data.ReadRate, g.Binary), formatBytes(data.WriteRate, g.Binary))
+	}
+
+	value := g.thresholdValue(worst)
+	if value < g.WarningThreshold && g.WarningThreshold != 0 {
 		block.TextColor = colors.Bad
-	} else if da < g.OkThreshold && g.OkThreshold != 0 {
+	} else if value < g.OkThreshold && g.OkThreshold != 0 {
 		block.TextColor = colors.Warning
 	}
 
+	body := fmt.Sprintf("%.1f%s available on %s", worst.Available, data.Unit, worst.MountPath)
+	if g.PercentThresholds {
+		body = fmt.Sprintf("%.0f%% available on %s", value, worst.MountPath)
+	}
+	g.ThresholdAlert.check(g.name+g.instance(), float64(value), notify.Thresholds{
+		Warning:      float64(g.OkThreshold),
+		Bad:          float64(g.WarningThreshold),
+		LowerIsWorse: true,
+	}, "Low disk space", body)
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
 	return block, nil
 }
 
+func (g *Disk) instance() string {
+	return strings.Join(g.mountPaths(), " ")
+}
+
 func (g *Disk) GetNameAndInstance() (string, string) {
-	return g.name, g.MountPath
-}
\ No newline at end of file
+	return g.name, g.instance()
+}
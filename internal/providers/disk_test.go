@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseDiskstats(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     map[uint64]diskIOCounters
+		wantErr  bool
+	}{
+		{
+			// Kernels since 5.5 add discard and flush fields, which are
+			// ignored.
+			name: "recent kernel",
+			contents: ` 259       0 nvme0n1 412683 98143 28719354 96412 1102938 611204 51803672 1480271 0 591208 1632095 0 0 0 0 84213 55411
+ 259       1 nvme0n1p1 312 1740 12084 71 2 0 2 0 0 104 72 0 0 0 0 0 0
+ 259       2 nvme0n1p2 412251 96403 28703126 96317 1102936 611204 51803670 1480271 0 591048 1576588 0 0 0 0 0 0
+ 253       0 dm-0 508392 0 28700834 140388 1714141 0 51803670 3418544 0 595360 3558932 0 0 0 0 0 0
+`,
+			want: map[uint64]diskIOCounters{
+				unix.Mkdev(259, 0): {read: 28719354 * 512, written: 51803672 * 512},
+				unix.Mkdev(259, 1): {read: 12084 * 512, written: 2 * 512},
+				unix.Mkdev(259, 2): {read: 28703126 * 512, written: 51803670 * 512},
+				unix.Mkdev(253, 0): {read: 28700834 * 512, written: 51803670 * 512},
+			},
+		},
+		{
+			// Kernels before 4.18 only have the first 14 fields.
+			name:     "old kernel",
+			contents: "   8       0 sda 182736 3621 9718394 82719 283746 197364 28471826 1082736 0 281736 1165384\n",
+			want: map[uint64]diskIOCounters{
+				unix.Mkdev(8, 0): {read: 9718394 * 512, written: 28471826 * 512},
+			},
+		},
+		{
+			name:     "short lines are skipped",
+			contents: "   8       1 sda1 1234 5678\n\n   8       0 sda 10 0 20 0 30 0 40 0 0 0 0\n",
+			want: map[uint64]diskIOCounters{
+				unix.Mkdev(8, 0): {read: 20 * 512, written: 40 * 512},
+			},
+		},
+		{
+			name:     "invalid counter",
+			contents: "   8       0 sda 10 0 2x0 0 30 0 40 0 0 0 0\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseDiskstats(test.contents)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseDiskstats() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("parseDiskstats() = %v, want %v", got, test.want)
+			}
+			for device, want := range test.want {
+				if got[device] != want {
+					t.Errorf("device %d:%d has counters %+v, want %+v", unix.Major(device), unix.Minor(device), got[device], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiskIORates(t *testing.T) {
+	sda := unix.Mkdev(8, 0)
+	now := time.Now()
+
+	tests := []struct {
+		name              string
+		previous, current map[uint64]diskIOCounters
+		wantRead          float64
+		wantWrite         float64
+		wantOK            bool
+	}{
+		{
+			name:      "increase",
+			previous:  map[uint64]diskIOCounters{sda: {read: 1000, written: 4000}},
+			current:   map[uint64]diskIOCounters{sda: {read: 3000, written: 4000}},
+			wantRead:  1000,
+			wantWrite: 0,
+			wantOK:    true,
+		},
+		{
+			// The sector counters are unsigned longs, so wrap around on
+			// 32-bit kernels.
+			name:      "wraparound",
+			previous:  map[uint64]diskIOCounters{sda: {read: (1<<32 - 10) * 512, written: 4000}},
+			current:   map[uint64]diskIOCounters{sda: {read: 20 * 512, written: 6000}},
+			wantRead:  0,
+			wantWrite: 1000,
+			wantOK:    true,
+		},
+		{
+			name:    "first sample",
+			current: map[uint64]diskIOCounters{sda: {read: 3000, written: 4000}},
+		},
+		{
+			name:     "device removed",
+			previous: map[uint64]diskIOCounters{sda: {read: 3000, written: 4000}},
+			current:  map[uint64]diskIOCounters{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &Disk{
+				previousIO: diskIOSample{time: now.Add(-2 * time.Second), devices: test.previous},
+				currentIO:  diskIOSample{time: now, devices: test.current},
+			}
+			read, write, ok := g.ioRates(sda)
+			if ok != test.wantOK || read != test.wantRead || write != test.wantWrite {
+				t.Errorf("ioRates() = %v, %v, %v, want %v, %v, %v", read, write, ok, test.wantRead, test.wantWrite, test.wantOK)
+			}
+		})
+	}
+}
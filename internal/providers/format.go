@@ -0,0 +1,255 @@
+package providers
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/codemicro/bar/internal/i3bar"
+)
+
+// TextFormat holds optional text/template format strings that replace a
+// provider's default full and short text. Providers that support custom
+// formats embed a TextFormat and call apply with a value describing what the
+// block displays.
+type TextFormat struct {
+	FullFormat  string `toml:"full_format"`
+	ShortFormat string `toml:"short_format"`
+
+	full, short *template.Template
+}
+
+var formatFuncs = template.FuncMap{
+	"humanizeBytes":        humanizeBytes,
+	"humanizeDecimalBytes": humanizeDecimalBytes,
+	"round":                round,
+	"pad":                  pad,
+	"bar":                  bar,
+	"trackTime":            formatTrackTime,
+	"sparkline":            sparklineFunc,
+}
+
+func parseFormat(name, format string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(formatFuncs).Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, &OptionError{Option: name, Err: err}
+	}
+	return tmpl, nil
+}
+
+func (f *TextFormat) validate() error {
+	var err error
+	if f.FullFormat != "" && f.full == nil {
+		if f.full, err = parseFormat("full_format", f.FullFormat); err != nil {
+			return err
+		}
+	}
+	if f.ShortFormat != "" && f.short == nil {
+		if f.short, err = parseFormat("short_format", f.ShortFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func executeFormat(tmpl *template.Template, data any) (string, error) {
+	sb := new(strings.Builder)
+	if err := tmpl.Execute(sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// executeFull executes the full format with data. ok is false if no full
+// format is configured.
+func (f *TextFormat) executeFull(data any) (text string, ok bool, err error) {
+	if err := f.validate(); err != nil {
+		return "", false, err
+	}
+	if f.full == nil {
+		return "", false, nil
+	}
+	text, err = executeFormat(f.full, data)
+	return text, err == nil, err
+}
+
+// executeShort executes the short format with data. ok is false if no short
+// format is configured.
+func (f *TextFormat) executeShort(data any) (text string, ok bool, err error) {
+	if err := f.validate(); err != nil {
+		return "", false, err
+	}
+	if f.short == nil {
+		return "", false, nil
+	}
+	text, err = executeFormat(f.short, data)
+	return text, err == nil, err
+}
+
+// apply replaces the full and short text of block with the output of the
+// configured formats, executed with data. Any text that doesn't have a format
+// configured is left as-is.
+func (f *TextFormat) apply(block *i3bar.Block, data any) error {
+	escape := func(s string) string {
+		if block.Markup == "pango" {
+			return i3bar.EscapePango(s)
+		}
+		return s
+	}
+
+	full, ok, err := f.executeFull(data)
+	if err != nil {
+		return err
+	}
+	if ok {
+		block.FullText = escape(full)
+	}
+
+	short, ok, err := f.executeShort(data)
+	if err != nil {
+		return err
+	}
+	if ok {
+		block.ShortText = escape(short)
+	}
+
+	return nil
+}
+
+// toFloat converts any numeric value into a float64.
+func toFloat(x any) (float64, error) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", x)
+}
+
+var (
+	binaryByteUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	decimalByteUnits = []string{"B", "kB", "MB", "GB", "TB", "PB"}
+)
+
+// formatBytes formats a number of bytes using binary prefixes, for example
+// "1.5 GiB", or decimal prefixes, for example "1.5 GB".
+func formatBytes(n float64, binary bool) string {
+	units, base := decimalByteUnits, 1000.0
+	if binary {
+		units, base = binaryByteUnits, 1024
+	}
+
+	i := 0
+	for math.Abs(n) >= base && i < len(units)-1 {
+		n /= base
+		i += 1
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// gigabyteUnit returns the name and size in bytes of a binary gigabyte (GiB)
+// or a decimal gigabyte (GB).
+func gigabyteUnit(binary bool) (unit string, size float32) {
+	if binary {
+		return "GiB", 1024 * 1024 * 1024
+	}
+	return "GB", 1000 * 1000 * 1000
+}
+
+// humanizeBytes formats a number of bytes using binary prefixes, for example
+// "1.5 GiB".
+func humanizeBytes(x any) (string, error) {
+	n, err := toFloat(x)
+	if err != nil {
+		return "", err
+	}
+	return formatBytes(n, true), nil
+}
+
+// humanizeDecimalBytes formats a number of bytes using decimal prefixes, for
+// example "1.5 GB".
+func humanizeDecimalBytes(x any) (string, error) {
+	n, err := toFloat(x)
+	if err != nil {
+		return "", err
+	}
+	return formatBytes(n, false), nil
+}
+
+// round rounds x to the given number of decimal places.
+func round(places int, x any) (float64, error) {
+	n, err := toFloat(x)
+	if err != nil {
+		return 0, err
+	}
+	shift := math.Pow(10, float64(places))
+	return math.Round(n*shift) / shift, nil
+}
+
+// pad pads x with spaces to be at least width characters wide. A positive
+// width right-aligns x and a negative width left-aligns it.
+func pad(width int, x any) string {
+	return fmt.Sprintf("%*v", width, x)
+}
+
+// bar renders a percentage between 0 and 100 as a horizontal bar width
+// characters wide.
+func bar(width int, percent any) (string, error) {
+	p, err := toFloat(percent)
+	if err != nil {
+		return "", err
+	}
+	p = math.Max(0, math.Min(100, p))
+
+	filled := int(math.Round(p / 100 * float64(width)))
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled), nil
+}
+
+var sparklineChars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values between 0 and max as a sparkline, with one
+// character per value.
+func sparkline(values []float32, max float64) string {
+	runes := make([]rune, len(values))
+	for i, value := range values {
+		n := int(math.Round(float64(value) / max * float64(len(sparklineChars)-1)))
+		n = int(math.Max(0, math.Min(float64(len(sparklineChars)-1), float64(n))))
+		runes[i] = sparklineChars[n]
+	}
+	return string(runes)
+}
+
+// sparklineFunc is the template version of sparkline, which accepts a slice of
+// any numeric type.
+func sparklineFunc(max any, values any) (string, error) {
+	m, err := toFloat(max)
+	if err != nil {
+		return "", err
+	}
+
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("expected a list of numbers, got %T", values)
+	}
+
+	floats := make([]float32, v.Len())
+	for i := range floats {
+		f, err := toFloat(v.Index(i).Interface())
+		if err != nil {
+			return "", err
+		}
+		floats[i] = float32(f)
+	}
+
+	return sparkline(floats, m), nil
+}
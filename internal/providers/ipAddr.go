@@ -1,15 +1,21 @@
 package providers
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/codemicro/bar/internal/i3bar"
-	"github.com/samber/lo"
 )
 
 type IPAddress struct {
-	Adapter string
+	// Adapter is the name of the interface to show. If blank, the interface
+	// used by the default route is shown.
+	Adapter string `toml:"adapter"`
+	// ShowIPv6 shows IPv6 addresses as well as IPv4 addresses.
+	ShowIPv6 bool `toml:"show_ipv6"`
+	TextFormat
 
 	name string
 }
@@ -25,62 +31,105 @@ func (g *IPAddress) Frequency() uint8 {
 	return 5
 }
 
-func (g *IPAddress) getAdapterIPAddress() (string, error) {
-	// call ifconfig
-	output, err := runCommand("ifconfig")
-	if err != nil {
-		return "", err
-	}
+// errAdapterNotFound is returned when the configured adapter doesn't exist.
+var errAdapterNotFound = errors.New("adapter not found")
 
-	adapters := lo.Filter(
-		strings.Split(string(output), "\n\n"),
-		func(x string, _ int) bool {
-			return x != ""
-		},
-	)
+// ipAddressData is the data available to IPAddress formats.
+type ipAddressData struct {
+	Adapter string
+	// Address is the first IPv4 address, or the first IPv6 address if there
+	// are no IPv4 addresses. It is empty if the adapter has no address.
+	Address string
+	// IPv4 and IPv6 are every address of the adapter. Link-local addresses
+	// are excluded.
+	IPv4 []string
+	IPv6 []string
+}
 
-	var ipAddr string
+func (g *IPAddress) getData() (*ipAddressData, error) {
+	name := g.Adapter
+	if name == "" {
+		var err error
+		if name, err = defaultRouteInterface(); err != nil {
+			if errors.Is(err, errNoDefaultRoute) {
+				return &ipAddressData{}, nil
+			}
+			return nil, err
+		}
+	}
 
-	// parse output
-	// split by \n\n
-	for _, adapter := range adapters {
-		fields := strings.Fields(adapter)
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		// The net package doesn't export an error for a missing
+		// interface, so any failure is treated as the adapter not existing.
+		return nil, errAdapterNotFound
+	}
 
-		if !strings.EqualFold(
-			strings.TrimSuffix(fields[0], ":"), g.Adapter,
-		) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ipAddressData{Adapter: name}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
 			continue
 		}
-
-		for i, field := range fields {
-			if field == "inet" {
-				ipAddr = fields[i+1]
-				break
-			}
+		if ipNet.IP.To4() != nil {
+			data.IPv4 = append(data.IPv4, ipNet.IP.String())
+		} else {
+			data.IPv6 = append(data.IPv6, ipNet.IP.String())
 		}
 	}
 
-	return ipAddr, nil
+	if len(data.IPv4) != 0 {
+		data.Address = data.IPv4[0]
+	} else if len(data.IPv6) != 0 {
+		data.Address = data.IPv6[0]
+	}
+
+	return data, nil
 }
 
 func (g *IPAddress) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
-	ipAddr, err := g.getAdapterIPAddress()
-	if err != nil {
-		return nil, err
-	}
-
 	block := &i3bar.Block{
-		Name: g.name,
+		Name:     g.name,
 		Instance: g.Adapter,
 	}
 
-	if ipAddr == "" {
+	data, err := g.getData()
+	if errors.Is(err, errAdapterNotFound) {
+		// The adapter can disappear at any time, for example if it's a USB
+		// adapter or a VPN tunnel.
+		data = &ipAddressData{Adapter: g.Adapter}
 		block.TextColor = colors.Bad
-		block.FullText = fmt.Sprintf("%s no IP", g.Adapter)
+		block.FullText = fmt.Sprintf("%s not found", g.Adapter)
+		block.ShortText = "not found"
+	} else if err != nil {
+		return nil, err
+	} else if data.Adapter == "" {
+		block.TextColor = colors.Bad
+		block.FullText = "no network"
+		block.ShortText = "no network"
+	} else if data.Address == "" {
+		block.TextColor = colors.Bad
+		block.FullText = fmt.Sprintf("%s no IP", data.Adapter)
 		block.ShortText = "no IP"
 	} else {
 		block.TextColor = colors.Good
-		block.FullText = ipAddr
+		if g.ShowIPv6 {
+			block.FullText = strings.Join(append(append([]string{}, data.IPv4...), data.IPv6...), " ")
+		} else if len(data.IPv4) != 0 {
+			block.FullText = data.IPv4[0]
+		} else {
+			block.FullText = data.Address
+		}
+		block.ShortText = data.Address
+	}
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
 	}
 
 	return block, nil
@@ -88,4 +137,4 @@ func (g *IPAddress) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
 
 func (g *IPAddress) GetNameAndInstance() (string, string) {
 	return g.name, g.Adapter
-}
\ No newline at end of file
+}
@@ -1,14 +1,15 @@
 package providers
 
 import (
+	"errors"
 	"github.com/codemicro/bar/internal/i3bar"
 	"os"
 	"github.com/rs/zerolog/log"
 )
 
 type LaunchProgram struct {
-	Text       string
-	Executable string
+	Text       string `toml:"text"`
+	Executable string `toml:"executable"`
 
 	name string
 }
@@ -21,6 +22,13 @@ func NewLaunchProgram(text string, executable string) i3bar.BlockGenerator {
 	}
 }
 
+func (g *LaunchProgram) validate() error {
+	if g.Executable == "" {
+		return errors.New("executable must be set")
+	}
+	return nil
+}
+
 func (g *LaunchProgram) Frequency() uint8 {
 	return 0
 }
@@ -41,7 +49,10 @@ func (g *LaunchProgram) OnClick(event *i3bar.ClickEvent) bool {
 		return false
 	}
 
-	process, err := os.StartProcess(g.Executable, []string{g.Executable}, &os.ProcAttr{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}})
+	process, err := os.StartProcess(g.Executable, []string{g.Executable}, &os.ProcAttr{
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys:   ownProcessGroup(),
+	})
 	if err != nil {
 		log.Error().Err(err).Str("location", "launchProgram_onClick").Msg("Could not start process")
 		return false
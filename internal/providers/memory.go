@@ -1,18 +1,49 @@
 package providers
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"regexp"
+	"io"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
+)
+
+// Modes for Memory.
+const (
+	memoryModeUsed      = "used"
+	memoryModeAvailable = "available"
+	memoryModePercent   = "percent"
 )
 
 type Memory struct {
-	OkThreshold      float32
-	WarningThreshold float32
+	// OkThreshold and WarningThreshold are compared with the available
+	// memory, in GB or GiB depending on Binary. If PercentThresholds is set,
+	// they are a percentage of the total memory instead.
+	OkThreshold       float32 `toml:"ok_threshold"`
+	WarningThreshold  float32 `toml:"warning_threshold"`
+	PercentThresholds bool    `toml:"percent_thresholds"`
+	// Mode is one of "used" (used and total), "available" or "percent"
+	// (percentage used).
+	Mode string `toml:"mode"`
+	// Binary uses binary units, such as GiB, instead of decimal units, such
+	// as GB.
+	Binary bool `toml:"binary"`
+	// ShowCache shows the memory used by buffers and the page cache, which
+	// is counted as available.
+	ShowCache bool `toml:"show_cache"`
+	// ShowSwap shows swap usage.
+	ShowSwap bool `toml:"show_swap"`
+	// ShowZram shows how much data is stored in zram devices and how well
+	// it has been compressed.
+	ShowZram bool `toml:"show_zram"`
+	TextFormat
+	ThresholdAlert
 
 	name string
 }
@@ -21,70 +52,289 @@ func NewMemory(okThreshold, warningThreshold float32) i3bar.BlockGenerator {
 	return &Memory{
 		OkThreshold:      okThreshold,
 		WarningThreshold: warningThreshold,
+		Mode:             memoryModeUsed,
+		ThresholdAlert:   newThresholdAlert(0.25),
 		name:             "memory",
 	}
 }
 
+func (g *Memory) validate() error {
+	switch g.Mode {
+	case memoryModeUsed, memoryModeAvailable, memoryModePercent:
+	default:
+		return fmt.Errorf("unknown mode %q, must be one of %q, %q or %q", g.Mode, memoryModeUsed, memoryModeAvailable, memoryModePercent)
+	}
+	return g.TextFormat.validate()
+}
+
 func (g *Memory) Frequency() uint8 {
 	return 2
 }
 
-var (
-	memoryTotalRegexp     = regexp.MustCompile(`MemTotal: +(\d+) kB`)
-	memoryAvailableRegexp = regexp.MustCompile(`MemAvailable: +(\d+) kB`)
-)
+// meminfo is the contents of /proc/meminfo that are of interest. All values
+// are in bytes.
+type meminfo struct {
+	memTotal, memAvailable        uint64
+	buffers, cached, sReclaimable uint64
+	swapTotal, swapFree           uint64
+}
+
+// parseMeminfo parses the contents of /proc/meminfo.
+func parseMeminfo(r io.Reader) (*meminfo, error) {
+	var (
+		info                       meminfo
+		foundTotal, foundAvailable bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		var field *uint64
+		switch key {
+		case "MemTotal":
+			field, foundTotal = &info.memTotal, true
+		case "MemAvailable":
+			field, foundAvailable = &info.memAvailable, true
+		case "Buffers":
+			field = &info.buffers
+		case "Cached":
+			field = &info.cached
+		case "SReclaimable":
+			field = &info.sReclaimable
+		case "SwapTotal":
+			field = &info.swapTotal
+		case "SwapFree":
+			field = &info.swapFree
+		default:
+			continue
+		}
 
-func (g *Memory) getStats() (used float32, total float32, err error) {
-	fcont, err := ioutil.ReadFile("/proc/meminfo")
+		// Despite the name, values listed in kB are in KiB.
+		value = strings.TrimSpace(value)
+		multiplier := uint64(1)
+		if strings.HasSuffix(value, " kB") {
+			value = strings.TrimSuffix(value, " kB")
+			multiplier = 1024
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", key, err)
+		}
+		*field = n * multiplier
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !foundTotal {
+		return nil, errors.New("could not fetch total system memory")
+	}
+	if !foundAvailable {
+		return nil, errors.New("could not fetch available system memory")
+	}
+
+	return &info, nil
+}
+
+// zramStats is the total usage of every zram device in bytes.
+type zramStats struct {
+	// original is the size of the data stored, before compression.
+	original uint64
+	// compressed is the size of the data after compression.
+	compressed uint64
+	// used is the memory used to store the data, including overheads.
+	used uint64
+}
+
+// getZramStats reads mm_stat from every zram device.
+func getZramStats() (*zramStats, error) {
+	files, err := filepath.Glob("/sys/block/zram*/mm_stat")
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	if x := memoryTotalRegexp.FindSubmatch(fcont); len(x) == 2 {
-		totalKB, err := strconv.ParseInt(string(x[1]), 10, 64)
+	stats := new(zramStats)
+	for _, file := range files {
+		contents, err := readTrimmedFile(file)
 		if err != nil {
-			return 0, 0, err
+			// Devices can be removed at any time.
+			continue
 		}
-		total = float32(totalKB) / float32(1000*1000)
-	} else {
-		return 0, 0, errors.New("could not fetch total system memory")
+
+		fields := strings.Fields(contents)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected format of %s", file)
+		}
+
+		var values [3]uint64
+		for i := range values {
+			if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+
+		stats.original += values[0]
+		stats.compressed += values[1]
+		stats.used += values[2]
+	}
+	return stats, nil
+}
+
+// memoryData is the data available to Memory formats. Sizes are in GB, or
+// GiB if binary units are used.
+type memoryData struct {
+	Used      float32
+	Available float32
+	Total     float32
+	// Percent is the percentage of memory that is used.
+	Percent float32
+	// Buffers and Cached are the memory used by buffers and by the page
+	// cache and reclaimable kernel caches, and are counted as available.
+	Buffers float32
+	Cached  float32
+
+	SwapUsed  float32
+	SwapTotal float32
+	// SwapPercent is the percentage of swap that is used, or zero if there
+	// is no swap.
+	SwapPercent float32
+
+	// ZramOriginal is the size of the data stored in zram devices, and
+	// ZramUsed is the memory used to store it. They are only set if
+	// ShowZram is set.
+	ZramOriginal float32
+	ZramUsed     float32
+	// ZramRatio is the compression ratio of zram devices, or zero if
+	// nothing is stored in them.
+	ZramRatio float32
+
+	// Unit is "GB" or "GiB".
+	Unit string
+}
+
+func (g *Memory) getData() (*memoryData, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := parseMeminfo(f)
+	if err != nil {
+		return nil, err
 	}
 
-	var available float32
-	if x := memoryAvailableRegexp.FindSubmatch(fcont); len(x) == 2 {
-		availableKB, err := strconv.ParseInt(string(x[1]), 10, 64)
+	unit, divisor := gigabyteUnit(g.Binary)
+	size := func(n uint64) float32 {
+		return float32(n) / divisor
+	}
+
+	data := &memoryData{
+		Used:      size(info.memTotal - info.memAvailable),
+		Available: size(info.memAvailable),
+		Total:     size(info.memTotal),
+		Buffers:   size(info.buffers),
+		Cached:    size(info.cached + info.sReclaimable),
+		SwapUsed:  size(info.swapTotal - info.swapFree),
+		SwapTotal: size(info.swapTotal),
+		Unit:      unit,
+	}
+	if info.memTotal != 0 {
+		data.Percent = float32(info.memTotal-info.memAvailable) / float32(info.memTotal) * 100
+	}
+	if info.swapTotal != 0 {
+		data.SwapPercent = float32(info.swapTotal-info.swapFree) / float32(info.swapTotal) * 100
+	}
+
+	if g.ShowZram {
+		zram, err := getZramStats()
 		if err != nil {
-			return 0, 0, err
+			return nil, err
+		}
+		data.ZramOriginal = size(zram.original)
+		data.ZramUsed = size(zram.used)
+		if zram.compressed != 0 {
+			data.ZramRatio = float32(zram.original) / float32(zram.compressed)
 		}
-		available = float32(availableKB) / float32(1000*1000)
-	} else {
-		return 0, 0, errors.New("could not fetch available system memory")
 	}
 
-	used = total - available
+	return data, nil
+}
 
-	return
+// thresholdValue returns the value that is compared with the thresholds.
+func (g *Memory) thresholdValue(data *memoryData) float32 {
+	if g.PercentThresholds {
+		return 100 - data.Percent
+	}
+	return data.Available
 }
 
 func (g *Memory) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
-	used, total, err := g.getStats()
+	data, err := g.getData()
 	if err != nil {
 		return nil, err
 	}
-	avail := total - used
 
 	block := &i3bar.Block{
-		Name:      g.name,
-		FullText:  fmt.Sprintf("Mem: %.1f/%.1fGB", used, total),
-		ShortText: fmt.Sprintf("M: %.1fGB", used),
+		Name: g.name,
+	}
+
+	fullText := new(strings.Builder)
+	switch g.Mode {
+	case memoryModeAvailable:
+		fmt.Fprintf(fullText, "Mem: %.1f%s", data.Available, data.Unit)
+		block.ShortText = fmt.Sprintf("M: %.1f%s", data.Available, data.Unit)
+	case memoryModePercent:
+		fmt.Fprintf(fullText, "Mem: %.0f%%", data.Percent)
+		block.ShortText = fmt.Sprintf("M: %.0f%%", data.Percent)
+	default:
+		fmt.Fprintf(fullText, "Mem: %.1f/%.1f%s", data.Used, data.Total, data.Unit)
+		block.ShortText = fmt.Sprintf("M: %.1f%s", data.Used, data.Unit)
+	}
+
+	if g.ShowCache {
+		fmt.Fprintf(fullText, " cache:%.1f%s", data.Buffers+data.Cached, data.Unit)
+	}
+
+	if g.ShowSwap && data.SwapTotal != 0 {
+		if g.Mode == memoryModePercent {
+			fmt.Fprintf(fullText, " Swap: %.0f%%", data.SwapPercent)
+		} else {
+			fmt.Fprintf(fullText, " Swap: %.1f/%.1f%s", data.SwapUsed, data.SwapTotal, data.Unit)
+		}
 	}
 
-	if avail < g.WarningThreshold && g.WarningThreshold != 0 {
+	if g.ShowZram && data.ZramRatio != 0 {
+		fmt.Fprintf(fullText, " zram: %.1f%s %.1fx", data.ZramOriginal, data.Unit, data.ZramRatio)
+	}
+
+	block.FullText = fullText.String()
+
+	value := g.thresholdValue(data)
+	if value < g.WarningThreshold && g.WarningThreshold != 0 {
 		block.TextColor = colors.Bad
-	} else if avail < g.OkThreshold && g.OkThreshold != 0 {
+	} else if value < g.OkThreshold && g.OkThreshold != 0 {
 		block.TextColor = colors.Warning
 	}
 
+	body := fmt.Sprintf("%.1f%s of memory available", data.Available, data.Unit)
+	if g.PercentThresholds {
+		body = fmt.Sprintf("%.0f%% of memory available", value)
+	}
+	g.ThresholdAlert.check(g.name, float64(value), notify.Thresholds{
+		Warning:      float64(g.OkThreshold),
+		Bad:          float64(g.WarningThreshold),
+		LowerIsWorse: true,
+	}, "Low memory", body)
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
 	return block, nil
 }
 
@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     meminfo
+		wantErr  string
+	}{
+		{
+			name: "recent kernel",
+			contents: `MemTotal:       32746364 kB
+MemFree:         9112044 kB
+MemAvailable:   21409872 kB
+Buffers:          512448 kB
+Cached:         11623100 kB
+SwapCached:            0 kB
+Active:          8215252 kB
+Inactive:       13092456 kB
+SwapTotal:       8388604 kB
+SwapFree:        8126460 kB
+Shmem:            896212 kB
+KReclaimable:     804316 kB
+Slab:            1204104 kB
+SReclaimable:     804316 kB
+SUnreclaim:       399788 kB
+HugePages_Total:       0
+HugePages_Free:        0
+Hugepagesize:       2048 kB
+`,
+			want: meminfo{
+				memTotal:     32746364 * 1024,
+				memAvailable: 21409872 * 1024,
+				buffers:      512448 * 1024,
+				cached:       11623100 * 1024,
+				sReclaimable: 804316 * 1024,
+				swapTotal:    8388604 * 1024,
+				swapFree:     8126460 * 1024,
+			},
+		},
+		{
+			name: "no swap",
+			contents: `MemTotal:        2014256 kB
+MemFree:          170132 kB
+MemAvailable:    1309708 kB
+Buffers:           96344 kB
+Cached:          1076600 kB
+SwapTotal:             0 kB
+SwapFree:              0 kB
+`,
+			want: meminfo{
+				memTotal:     2014256 * 1024,
+				memAvailable: 1309708 * 1024,
+				buffers:      96344 * 1024,
+				cached:       1076600 * 1024,
+			},
+		},
+		{
+			// MemAvailable was added in Linux 3.14.
+			name: "no MemAvailable",
+			contents: `MemTotal:        1017796 kB
+MemFree:          101284 kB
+Buffers:           62368 kB
+Cached:           612380 kB
+SwapTotal:       1048572 kB
+SwapFree:        1048572 kB
+`,
+			wantErr: "could not fetch available system memory",
+		},
+		{
+			name:     "no MemTotal",
+			contents: "MemAvailable:   21409872 kB\n",
+			wantErr:  "could not fetch total system memory",
+		},
+		{
+			name:     "invalid value",
+			contents: "MemTotal:       32746364 kB\nMemAvailable:   lots kB\n",
+			wantErr:  "could not parse MemAvailable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseMeminfo(strings.NewReader(test.contents))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("parseMeminfo() returned error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != test.want {
+				t.Errorf("parseMeminfo() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
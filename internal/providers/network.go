@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/josharian/native"
+)
+
+// errNoDefaultRoute is returned by defaultRouteInterface when there is no
+// default route, for example because the machine is offline.
+var errNoDefaultRoute = errors.New("no default route")
+
+// defaultRouteInterface returns the name of the interface used by the default
+// route, preferring IPv4 routes and then the route with the lowest metric.
+func defaultRouteInterface() (string, error) {
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		index, err := defaultRouteIndex(family)
+		if err != nil {
+			return "", err
+		}
+		if index == 0 {
+			continue
+		}
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			return "", err
+		}
+		return iface.Name, nil
+	}
+	return "", errNoDefaultRoute
+}
+
+// defaultRouteIndex returns the index of the interface used by the default
+// route for the given address family, or zero if there isn't one.
+func defaultRouteIndex(family int) (int, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, family)
+	if err != nil {
+		return 0, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		bestIndex  int
+		bestMetric uint32
+	)
+
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWROUTE || len(msg.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+
+		// The fields needed from the route message header are all single
+		// bytes, so don't depend on the host's byte order.
+		dstLen, table, routeType := msg.Data[1], msg.Data[4], msg.Data[7]
+		if dstLen != 0 || table != syscall.RT_TABLE_MAIN || routeType != syscall.RTN_UNICAST {
+			continue
+		}
+
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			return 0, err
+		}
+
+		var (
+			index  int
+			metric uint32
+		)
+		for _, attr := range attrs {
+			if len(attr.Value) < 4 {
+				continue
+			}
+			switch attr.Attr.Type {
+			case syscall.RTA_OIF:
+				index = int(native.Endian.Uint32(attr.Value))
+			case syscall.RTA_PRIORITY:
+				metric = native.Endian.Uint32(attr.Value)
+			}
+		}
+
+		if index != 0 && (bestIndex == 0 || metric < bestMetric) {
+			bestIndex, bestMetric = index, metric
+		}
+	}
+
+	return bestIndex, nil
+}
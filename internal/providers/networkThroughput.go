@@ -0,0 +1,253 @@
+package providers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codemicro/bar/internal/i3bar"
+)
+
+type NetworkThroughput struct {
+	// Adapter is the name of the interface to show. If blank, the interface
+	// used by the default route is shown.
+	Adapter string `toml:"adapter"`
+	// All sums the traffic of every interface except loopback interfaces,
+	// and takes precedence over Adapter.
+	All bool `toml:"all"`
+	// OkThreshold and WarningThreshold are in MiB/s, and are compared with
+	// the higher of the download and upload rates. Rates above them are shown
+	// as a warning and bad respectively.
+	OkThreshold      float32 `toml:"ok_threshold"`
+	WarningThreshold float32 `toml:"warning_threshold"`
+	TextFormat
+
+	previous, current netSample
+
+	name string
+}
+
+func NewNetworkThroughput(adapter string, okThreshold, warningThreshold float32) i3bar.BlockGenerator {
+	return &NetworkThroughput{
+		Adapter:          adapter,
+		OkThreshold:      okThreshold,
+		WarningThreshold: warningThreshold,
+		name:             "networkThroughput",
+	}
+}
+
+func (g *NetworkThroughput) Frequency() uint8 {
+	return 2
+}
+
+// netCounters is the number of bytes received and transmitted by an
+// interface, as listed in /proc/net/dev.
+type netCounters struct {
+	rx, tx uint64
+}
+
+// netSample is a reading of the counters of every interface.
+type netSample struct {
+	time       time.Time
+	interfaces map[string]netCounters
+}
+
+// parseNetDev parses the contents of /proc/net/dev.
+func parseNetDev(r io.Reader) (map[string]netCounters, error) {
+	interfaces := make(map[string]netCounters)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// The first two lines are headers, which don't contain a colon
+		// after the interface name.
+		name, stats, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(stats)
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("unexpected /proc/net/dev format for %s", strings.TrimSpace(name))
+		}
+
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		interfaces[strings.TrimSpace(name)] = netCounters{rx: rx, tx: tx}
+	}
+
+	return interfaces, scanner.Err()
+}
+
+func (g *NetworkThroughput) doSample() error {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	interfaces, err := parseNetDev(f)
+	if err != nil {
+		return err
+	}
+
+	g.previous = g.current
+	g.current = netSample{time: time.Now(), interfaces: interfaces}
+	return nil
+}
+
+// isLoopback reports whether the interface with the given name is a loopback
+// interface.
+func isLoopback(name string) bool {
+	// ARPHRD_LOOPBACK from include/uapi/linux/if_arp.h.
+	const arphrdLoopback = 772
+	linkType, err := readSysfsInt("/sys/class/net/" + name + "/type")
+	if err != nil {
+		return name == "lo"
+	}
+	return linkType == arphrdLoopback
+}
+
+// counterDelta returns how much a counter has increased by. Counters can go
+// backwards, for example when an interface is recreated, in which case the
+// increase is unknown and zero is returned.
+func counterDelta(previous, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// networkThroughputData is the data available to NetworkThroughput formats.
+// Rates are in bytes per second.
+type networkThroughputData struct {
+	// Adapter is the interface being shown, or empty if All is set.
+	Adapter string
+	// Interfaces are the names of the interfaces being shown.
+	Interfaces []string
+	RxRate     float64
+	TxRate     float64
+	// RxBytes and TxBytes are the total bytes received and transmitted
+	// since the interfaces were created.
+	RxBytes uint64
+	TxBytes uint64
+}
+
+func (g *NetworkThroughput) getData() (*networkThroughputData, error) {
+	if err := g.doSample(); err != nil {
+		return nil, err
+	}
+
+	data := new(networkThroughputData)
+
+	if g.All {
+		for name := range g.current.interfaces {
+			if !isLoopback(name) {
+				data.Interfaces = append(data.Interfaces, name)
+			}
+		}
+		sort.Strings(data.Interfaces)
+	} else {
+		data.Adapter = g.Adapter
+		if data.Adapter == "" {
+			var err error
+			if data.Adapter, err = defaultRouteInterface(); err != nil {
+				if errors.Is(err, errNoDefaultRoute) {
+					return data, nil
+				}
+				return nil, err
+			}
+		}
+		if _, found := g.current.interfaces[data.Adapter]; !found {
+			return nil, errAdapterNotFound
+		}
+		data.Interfaces = []string{data.Adapter}
+	}
+
+	seconds := g.current.time.Sub(g.previous.time).Seconds()
+
+	for _, name := range data.Interfaces {
+		current := g.current.interfaces[name]
+		data.RxBytes += current.rx
+		data.TxBytes += current.tx
+
+		// Interfaces can appear between samples, in which case they have
+		// no previous reading. Nothing has a previous reading on the first
+		// sample, so the rates start at zero.
+		previous, found := g.previous.interfaces[name]
+		if !found || seconds <= 0 {
+			continue
+		}
+		data.RxRate += float64(counterDelta(previous.rx, current.rx)) / seconds
+		data.TxRate += float64(counterDelta(previous.tx, current.tx)) / seconds
+	}
+
+	return data, nil
+}
+
+// humanizeRate formats a rate in bytes per second, for example "1.5 MiB/s".
+func humanizeRate(rate float64) string {
+	return formatBytes(rate, true) + "/s"
+}
+
+func (g *NetworkThroughput) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	block := &i3bar.Block{
+		Name:     g.name,
+		Instance: g.Adapter,
+	}
+
+	data, err := g.getData()
+	if errors.Is(err, errAdapterNotFound) {
+		data = &networkThroughputData{Adapter: g.Adapter}
+		block.TextColor = colors.Bad
+		block.FullText = fmt.Sprintf("%s not found", g.Adapter)
+		block.ShortText = "not found"
+	} else if err != nil {
+		return nil, err
+	} else if len(data.Interfaces) == 0 {
+		block.TextColor = colors.Bad
+		block.FullText = "no network"
+		block.ShortText = "no network"
+	} else {
+		label := "Net"
+		if data.Adapter != "" {
+			label = data.Adapter
+		}
+		block.FullText = fmt.Sprintf("%s: ↓%s ↑%s", label, humanizeRate(data.RxRate), humanizeRate(data.TxRate))
+		block.ShortText = fmt.Sprintf("↓%s ↑%s", humanizeRate(data.RxRate), humanizeRate(data.TxRate))
+
+		rate := float32(data.RxRate)
+		if data.TxRate > data.RxRate {
+			rate = float32(data.TxRate)
+		}
+		rate /= 1024 * 1024
+
+		if rate > g.WarningThreshold && g.WarningThreshold != 0 {
+			block.TextColor = colors.Bad
+		} else if rate > g.OkThreshold && g.OkThreshold != 0 {
+			block.TextColor = colors.Warning
+		}
+	}
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (g *NetworkThroughput) GetNameAndInstance() (string, string) {
+	return g.name, g.Adapter
+}
@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+const netDevSample = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 1963402   12843    0    0    0     0          0         0  1963402   12843    0    0    0     0       0          0
+enp5s0: 9137403226 7012449    0  412    0     0          0     51201 618940312 3021736    0    0    0     0       0          0
+wlan0:      0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+`
+
+func TestParseNetDev(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     map[string]netCounters
+		wantErr  bool
+	}{
+		{
+			name:     "interfaces",
+			contents: netDevSample,
+			want: map[string]netCounters{
+				"lo":     {rx: 1963402, tx: 1963402},
+				"enp5s0": {rx: 9137403226, tx: 618940312},
+				"wlan0":  {},
+			},
+		},
+		{
+			// Long interface names run into the received bytes.
+			name: "no space after colon",
+			contents: `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+wlp0s20f3:123456789  100000    0    0    0     0          0         0 98765432   50000    0    0    0     0       0          0
+`,
+			want: map[string]netCounters{
+				"wlp0s20f3": {rx: 123456789, tx: 98765432},
+			},
+		},
+		{
+			name:     "headers only",
+			contents: strings.Join(strings.Split(netDevSample, "\n")[:2], "\n"),
+			want:     map[string]netCounters{},
+		},
+		{
+			name:     "missing fields",
+			contents: "  eth0: 1234 10 0 0 0 0\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid counter",
+			contents: "  eth0: 12x4 10 0 0 0 0 0 0 5678 20 0 0 0 0 0 0\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseNetDev(strings.NewReader(test.contents))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseNetDev() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("parseNetDev() = %v, want %v", got, test.want)
+			}
+			for name, want := range test.want {
+				if got[name] != want {
+					t.Errorf("%s has counters %+v, want %+v", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current uint64
+		want              uint64
+	}{
+		{name: "increase", previous: 1000, current: 1500, want: 500},
+		{name: "unchanged", previous: 1000, current: 1000, want: 0},
+		// A counter that wraps around or is reset when its interface is
+		// recreated can't be told apart, so neither counts as traffic.
+		{name: "32-bit wraparound", previous: 1<<32 - 100, current: 50, want: 0},
+		{name: "reset", previous: 9137403226, current: 0, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := counterDelta(test.previous, test.current); got != test.want {
+				t.Errorf("counterDelta(%d, %d) = %d, want %d", test.previous, test.current, got, test.want)
+			}
+		})
+	}
+}
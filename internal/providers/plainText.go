@@ -3,7 +3,7 @@ package providers
 import "github.com/codemicro/bar/internal/i3bar"
 
 type PlainText struct {
-	Text string
+	Text string `toml:"text"`
 
 	name string
 }
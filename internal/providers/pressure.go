@@ -0,0 +1,205 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
+)
+
+// pressureResources are the resources that pressure stall information is
+// reported for, in the order they are shown.
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// pressureLabels are the shortened names of resources shown in the block.
+var pressureLabels = map[string]string{"cpu": "cpu", "memory": "mem", "io": "io"}
+
+type Pressure struct {
+	// OkThreshold and WarningThreshold are percentages of time that tasks
+	// were stalled over the last ten seconds, and are compared with the
+	// highest "some" value of every resource shown.
+	OkThreshold      float32 `toml:"ok_threshold"`
+	WarningThreshold float32 `toml:"warning_threshold"`
+	// Resources are the resources to show, out of "cpu", "memory" and "io".
+	Resources []string `toml:"resources"`
+	// ShowFull shows the percentage of time that every task was stalled,
+	// as well as the percentage of time that at least one was.
+	ShowFull bool `toml:"show_full"`
+	TextFormat
+	ThresholdAlert
+
+	name string
+}
+
+func NewPressure(okThreshold, warningThreshold float32) i3bar.BlockGenerator {
+	return &Pressure{
+		OkThreshold:      okThreshold,
+		WarningThreshold: warningThreshold,
+		Resources:        append([]string(nil), pressureResources...),
+		ThresholdAlert:   newThresholdAlert(5),
+		name:             "pressure",
+	}
+}
+
+func (g *Pressure) validate() error {
+	for _, resource := range g.Resources {
+		if _, found := pressureLabels[resource]; !found {
+			return fmt.Errorf("unknown resource %q, must be one of %q", resource, pressureResources)
+		}
+	}
+	return g.TextFormat.validate()
+}
+
+func (g *Pressure) Frequency() uint8 {
+	return 2
+}
+
+// pressureStall is the percentage of time that tasks were stalled waiting for
+// a resource, averaged over the last ten seconds. Some is the time that at
+// least one task was stalled, and Full is the time that every task was.
+type pressureStall struct {
+	Resource string
+	Some     float64
+	Full     float64
+}
+
+// parsePressure parses a file from /proc/pressure. Kernels before 5.13 don't
+// report "full" for the CPU, in which case it is left as zero. Every kernel
+// reports "some", so it's an error for it to be missing.
+func parsePressure(contents string) (some, full float64, err error) {
+	foundSome := false
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		var avg10 float64
+		found := false
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				if avg10, err = strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64); err != nil {
+					return 0, 0, err
+				}
+				found = true
+			}
+		}
+		if !found {
+			return 0, 0, fmt.Errorf("no avg10 in %q", line)
+		}
+
+		switch fields[0] {
+		case "some":
+			some, foundSome = avg10, true
+		case "full":
+			full = avg10
+		}
+	}
+	if !foundSome {
+		return 0, 0, errors.New("no some line")
+	}
+	return some, full, nil
+}
+
+// errNoPressure is returned when the kernel doesn't report pressure stall
+// information, either because it was built without it or because it was
+// disabled with psi=0.
+var errNoPressure = errors.New("pressure stall information not available")
+
+func (g *Pressure) getStalls() ([]pressureStall, error) {
+	var stalls []pressureStall
+	for _, resource := range g.Resources {
+		contents, err := ioutil.ReadFile(filepath.Join("/proc/pressure", resource))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.EOPNOTSUPP) {
+				return nil, errNoPressure
+			}
+			return nil, err
+		}
+
+		stall := pressureStall{Resource: resource}
+		if stall.Some, stall.Full, err = parsePressure(string(contents)); err != nil {
+			return nil, fmt.Errorf("could not parse %s pressure: %w", resource, err)
+		}
+		stalls = append(stalls, stall)
+	}
+	return stalls, nil
+}
+
+// pressureData is the data available to Pressure formats. All values are
+// percentages.
+type pressureData struct {
+	// Available is false if the kernel doesn't report pressure stall
+	// information.
+	Available bool
+	// Stalls has an item for each resource shown.
+	Stalls []pressureStall
+	// Max is the highest "some" value of every resource shown.
+	Max float64
+}
+
+func (g *Pressure) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	block := &i3bar.Block{
+		Name: g.name,
+	}
+
+	stalls, err := g.getStalls()
+	if errors.Is(err, errNoPressure) {
+		// There's nothing that can be done about this, so shouldn't be
+		// shown as an error.
+		block.FullText = "PSI: unavailable"
+		block.ShortText = "PSI: n/a"
+		if err := g.TextFormat.apply(block, &pressureData{}); err != nil {
+			return nil, err
+		}
+		return block, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	data := &pressureData{Available: true, Stalls: stalls}
+
+	parts := make([]string, len(stalls))
+	for i, stall := range stalls {
+		if stall.Some > data.Max {
+			data.Max = stall.Some
+		}
+		if g.ShowFull {
+			parts[i] = fmt.Sprintf("%s %.1f/%.1f", pressureLabels[stall.Resource], stall.Some, stall.Full)
+		} else {
+			parts[i] = fmt.Sprintf("%s %.1f", pressureLabels[stall.Resource], stall.Some)
+		}
+	}
+
+	block.FullText = "PSI: " + strings.Join(parts, " ")
+	block.ShortText = fmt.Sprintf("P: %.1f", data.Max)
+
+	p := float32(data.Max)
+	if p > g.WarningThreshold && g.WarningThreshold != 0 {
+		block.TextColor = colors.Bad
+	} else if p > g.OkThreshold && g.OkThreshold != 0 {
+		block.TextColor = colors.Warning
+	}
+
+	g.ThresholdAlert.check(g.name, data.Max, notify.Thresholds{
+		Warning: float64(g.OkThreshold),
+		Bad:     float64(g.WarningThreshold),
+	}, "High resource pressure", fmt.Sprintf("Tasks were stalled %.1f%% of the time", data.Max))
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (g *Pressure) GetNameAndInstance() (string, string) {
+	return g.name, ""
+}
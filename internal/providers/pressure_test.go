@@ -0,0 +1,81 @@
+package providers
+
+import "testing"
+
+func TestParsePressure(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantSome float64
+		wantFull float64
+		wantErr  bool
+	}{
+		{
+			name: "some and full",
+			contents: `some avg10=12.34 avg60=8.02 avg300=3.15 total=218473012
+full avg10=4.50 avg60=2.91 avg300=1.02 total=90183746
+`,
+			wantSome: 12.34,
+			wantFull: 4.5,
+		},
+		{
+			// Kernels before 5.13 don't report full for the CPU.
+			name:     "missing full",
+			contents: "some avg10=0.87 avg60=1.21 avg300=0.98 total=1832745610\n",
+			wantSome: 0.87,
+		},
+		{
+			// Kernels since 5.13 report full for the CPU, but it's always
+			// zero at the system level.
+			name: "zero full",
+			contents: `some avg10=0.87 avg60=1.21 avg300=0.98 total=1832745610
+full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+`,
+			wantSome: 0.87,
+		},
+		{
+			name: "fields in another order",
+			contents: `some total=218473012 avg300=3.15 avg60=8.02 avg10=12.34
+`,
+			wantSome: 12.34,
+		},
+		{
+			name:     "missing some",
+			contents: "full avg10=4.50 avg60=2.91 avg300=1.02 total=90183746\n",
+			wantErr:  true,
+		},
+		{
+			name:     "empty",
+			contents: "",
+			wantErr:  true,
+		},
+		{
+			name:     "missing avg10",
+			contents: "some avg60=8.02 avg300=3.15 total=218473012\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid avg10",
+			contents: "some avg10=high avg60=8.02 avg300=3.15 total=218473012\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			some, full, err := parsePressure(test.contents)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parsePressure() = %v, %v, want an error", some, full)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if some != test.wantSome || full != test.wantFull {
+				t.Errorf("parsePressure() = %v, %v, want %v, %v", some, full, test.wantSome, test.wantFull)
+			}
+		})
+	}
+}
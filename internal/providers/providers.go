@@ -3,12 +3,25 @@ package providers
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
+// ownProcessGroup returns the attributes needed to start a child process in
+// its own process group. i3bar sends the stop signal to the bar's whole
+// process group, and the default action of most of the signals it can be
+// configured to use is to terminate, so children in the bar's group would be
+// killed whenever the bar is hidden.
+func ownProcessGroup() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
 func runCommand(program string, args ...string) ([]byte, error) {
 	cmd := exec.Command(program, args...)
+	cmd.SysProcAttr = ownProcessGroup()
 	out, err := cmd.Output()
 	if err != nil {
 		ne := fmt.Errorf(`failed to execute "%v" (%+v)`, strings.Join(append([]string{program}, args...), " "), err)
@@ -19,3 +32,22 @@ func runCommand(program string, args ...string) ([]byte, error) {
 	}
 	return bytes.TrimSpace(out), err
 }
+
+// readTrimmedFile reads a file and removes any surrounding whitespace.
+func readTrimmedFile(filename string) (string, error) {
+	x, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(x)), nil
+}
+
+// readSysfsInt reads a file containing a single integer, as is common in
+// sysfs.
+func readSysfsInt(filename string) (int64, error) {
+	x, err := readTrimmedFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(x, 10, 64)
+}
@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/codemicro/bar/internal/pulse"
+	"github.com/rs/zerolog/log"
+)
+
+const pulseClientName = "cdmbar"
+
+var pulseConnection struct {
+	lock   sync.Mutex
+	client *pulse.Client
+}
+
+// getPulseClient returns a connection to the PulseAudio server that's shared
+// between all providers. If the previous connection was lost, a new one is
+// made.
+func getPulseClient() (*pulse.Client, error) {
+	pulseConnection.lock.Lock()
+	defer pulseConnection.lock.Unlock()
+
+	if c := pulseConnection.client; c != nil {
+		select {
+		case <-c.Done():
+			log.Debug().Err(c.Err()).Msg("reconnecting to PulseAudio")
+		default:
+			return c, nil
+		}
+	}
+
+	c, err := pulse.Dial(pulseClientName)
+	if err != nil {
+		return nil, err
+	}
+	pulseConnection.client = c
+	return c, nil
+}
+
+// watchPulse calls notify every time the server sends an event for any of the
+// facilities in mask. Each watcher has its own connection so that it receives
+// its own copy of every event.
+func watchPulse(ctx context.Context, state *watchState, notify func(), mask pulse.SubscriptionMask) error {
+	c, err := pulse.Dial(pulseClientName)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Subscribe(mask); err != nil {
+		return err
+	}
+
+	state.set(true)
+	defer state.set(false)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-c.Events():
+			if !ok {
+				return c.Err()
+			}
+			notify()
+		}
+	}
+}
+
+// volumeInfo is the data available to PulseaudioVolume and PulseaudioSource
+// formats.
+type volumeInfo struct {
+	Name        string
+	Description string
+	// Alias is the configured short name of the device, if any.
+	Alias string
+	// Percent is the average volume of all channels.
+	Percent int
+	// Channels is the volume of each channel as a percentage.
+	Channels []int
+	// Left and Right are the volumes of the front left and right channels.
+	// If the device doesn't have those channels, they're the same as
+	// Percent.
+	Left  int
+	Right int
+	Muted bool
+}
+
+func newVolumeInfo(device *pulse.Device) *volumeInfo {
+	v := &volumeInfo{
+		Name:        device.Name,
+		Description: device.Description,
+		Percent:     pulse.Percent(device.Volume.Average()),
+		Channels:    device.Volume.Percent(),
+		Muted:       device.Muted,
+	}
+	v.Left, v.Right = v.Percent, v.Percent
+
+	for i, position := range device.ChannelMap {
+		if i >= len(v.Channels) {
+			break
+		}
+		switch position {
+		case pulse.ChannelFrontLeft:
+			v.Left = v.Channels[i]
+		case pulse.ChannelFrontRight:
+			v.Right = v.Channels[i]
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,128 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/pulse"
+	"github.com/rs/zerolog/log"
+)
+
+// PulseaudioSource shows the volume and mute state of a PulseAudio source,
+// such as a microphone. The block is highlighted while the source is unmuted.
+type PulseaudioSource struct {
+	// Source is the target source name to look for in Pulseaudio. Leave
+	// blank to use the default source.
+	Source string `toml:"source"`
+	TextFormat
+
+	name  string
+	watch watchState
+}
+
+func NewPulseaudioSource() i3bar.BlockGenerator {
+	return &PulseaudioSource{
+		name: "pulseaudioSource",
+	}
+}
+
+func (g *PulseaudioSource) Frequency() uint8 {
+	if g.watch.isRunning() {
+		return 30
+	}
+	return 2
+}
+
+func (g *PulseaudioSource) Watch(ctx context.Context, notify func()) error {
+	// Changes to the default source are reported as changes to the server.
+	return watchPulse(ctx, &g.watch, notify, pulse.SubscribeSource|pulse.SubscribeServer)
+}
+
+func (g *PulseaudioSource) sourceName() string {
+	if g.Source == "" {
+		return "@DEFAULT_SOURCE@"
+	}
+	return g.Source
+}
+
+func (g *PulseaudioSource) getSource() (*pulse.Client, *pulse.Device, error) {
+	c, err := getPulseClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	source, err := c.Source(g.sourceName())
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get source %s: %w", g.sourceName(), err)
+	}
+	return c, source, nil
+}
+
+func (g *PulseaudioSource) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	_, source, err := g.getSource()
+	if err != nil {
+		return nil, err
+	}
+
+	v := newVolumeInfo(source)
+
+	block := new(i3bar.Block)
+	block.Name = g.name
+	block.Instance = g.Source
+
+	if v.Muted {
+		block.FullText = "Mic: muted"
+		block.ShortText = "M: mute"
+	} else {
+		block.FullText = fmt.Sprintf("Mic: %d%%", v.Percent)
+		block.ShortText = fmt.Sprintf("M: %d%%", v.Percent)
+		block.TextColor = colors.Bad
+	}
+
+	if err := g.TextFormat.apply(block, v); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (g *PulseaudioSource) GetNameAndInstance() (string, string) {
+	return g.name, g.Source
+}
+
+func (g *PulseaudioSource) applyVolumeDelta(percentageChange int) error {
+	c, source, err := g.getSource()
+	if err != nil {
+		return err
+	}
+	return c.SetSourceVolume(source.Name, source.Volume.AddPercent(percentageChange, 0))
+}
+
+func (g *PulseaudioSource) toggleMute() error {
+	c, source, err := g.getSource()
+	if err != nil {
+		return err
+	}
+	return c.SetSourceMute(source.Name, !source.Muted)
+}
+
+func (g *PulseaudioSource) OnClick(event *i3bar.ClickEvent) bool {
+	var err error
+
+	switch event.Button {
+	case i3bar.LeftMouseButton:
+		err = g.toggleMute()
+	case i3bar.MouseWheelScrollUp:
+		err = g.applyVolumeDelta(1)
+	case i3bar.MouseWheelScrollDown:
+		err = g.applyVolumeDelta(-1)
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("location", "pulseaudioSource_OnClick").Send()
+	}
+
+	return true
+}
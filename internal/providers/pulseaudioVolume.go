@@ -1,22 +1,25 @@
 package providers
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
 
 	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/pulse"
 	"github.com/rs/zerolog/log"
 )
 
 type PulseaudioVolume struct {
 	// Sink is the target sink name to look for in Pulseaudio. Leave blank
 	// to use the default sink.
-	Sink string
-
-	name string
+	Sink string `toml:"sink"`
+	// Aliases maps sink names to short names that are shown in the block
+	// instead of the "Vol" label.
+	Aliases map[string]string `toml:"aliases"`
+	TextFormat
+
+	name  string
+	watch watchState
 }
 
 func NewPulseaudioVolume() i3bar.BlockGenerator {
@@ -26,112 +29,48 @@ func NewPulseaudioVolume() i3bar.BlockGenerator {
 }
 
 func (g *PulseaudioVolume) Frequency() uint8 {
+	if g.watch.isRunning() {
+		return 30
+	}
 	return 2
 }
 
-func (g *PulseaudioVolume) getInfo() (string, error) {
-	x, err := runCommand("pacmd", "info")
-	return string(x), err
+func (g *PulseaudioVolume) Watch(ctx context.Context, notify func()) error {
+	// Changes to the default sink are reported as changes to the server.
+	return watchPulse(ctx, &g.watch, notify, pulse.SubscribeSink|pulse.SubscribeServer)
 }
 
-var (
-	pactlInfoDefaultSinkRegexp = regexp.MustCompile(`Default Sink: (.+)`)
-)
-
-func (g *PulseaudioVolume) getDefaultSink() (string, error) {
-	x, err := runCommand("pactl", "info")
-	if err != nil {
-		return "", err
-	}
-
-	submatches := pactlInfoDefaultSinkRegexp.FindSubmatch(x)
-	if len(submatches) == 0 {
-		return "", errors.New("unexpectedly formed `pactl info` output")
+func (g *PulseaudioVolume) sinkName() string {
+	if g.Sink == "" {
+		return "@DEFAULT_SINK@"
 	}
-
-	return string(submatches[1]), nil
+	return g.Sink
 }
 
-var (
-	pulseaudioInfoParseRegexp = regexp.MustCompile(`(\d+ sink\(s\) available\.|\d+ source\(s\) available\.)`)
-	pulseaudioVolumeRegexp    = regexp.MustCompile(`volume: front-left: \d+ \/ +(\d{1,3})% \/ (?:\d|.)+ dB, +front-right: \d+ \/ +(\d{1,3})% \/ (?:\d|.)+ dB`)
-	pulseaudioMutedRegexp     = regexp.MustCompile(`muted: (.+)`)
-	pulseaudioNameRegexp      = regexp.MustCompile(`name: <(.+)>`)
-)
-
-type volumeInfo struct {
-	Left  int
-	Right int
-	Muted bool
-}
-
-func (g *PulseaudioVolume) getVolume(info string) (*volumeInfo, error) {
-	x := pulseaudioInfoParseRegexp.Split(info, 5)
-
-	var targetSink string
-	if g.Sink == "" {
-		var err error
-		targetSink, err = g.getDefaultSink()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		targetSink = g.Sink
-	}
-
-	sinkInfoStrings := strings.Split(
-		strings.TrimLeft(x[1], "\n\t* "),
-		"index: ",
-	)[1:] // 1 onwards to remove the blank string at the beginning
-
-	for _, sinkText := range sinkInfoStrings {
-		v := new(volumeInfo)
-		name := pulseaudioNameRegexp.FindStringSubmatch(sinkText)
-		if len(name) == 2 && (strings.EqualFold(name[1], targetSink)) {
-			volumes := pulseaudioVolumeRegexp.FindStringSubmatch(sinkText)
-			muted := pulseaudioMutedRegexp.FindStringSubmatch(sinkText)[1]
-
-			if len(volumes) != 3 {
-				return nil, fmt.Errorf("could not parse volumes from sink %s", name[1])
-			}
-
-			vl, err := strconv.ParseInt(volumes[1], 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			v.Left = int(vl)
-
-			vr, err := strconv.ParseInt(volumes[2], 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			v.Right = int(vr)
-
-			switch strings.ToLower(muted) {
-			case "yes":
-				v.Muted = true
-			case "no":
-				v.Muted = false
-			default:
-				return nil, fmt.Errorf("unknown error state %#v", muted)
-			}
-
-			return v, nil
-		}
+func (g *PulseaudioVolume) getSink() (*pulse.Client, *pulse.Device, error) {
+	c, err := getPulseClient()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return nil, errors.New("no sink with the specified name found")
+	sink, err := c.Sink(g.sinkName())
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get sink %s: %w", g.sinkName(), err)
+	}
+	return c, sink, nil
 }
 
 func (g *PulseaudioVolume) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
-	info, err := g.getInfo()
+	_, sink, err := g.getSink()
 	if err != nil {
 		return nil, err
 	}
 
-	v, err := g.getVolume(info)
-	if err != nil {
-		return nil, err
+	v := newVolumeInfo(sink)
+	v.Alias = g.Aliases[sink.Name]
+
+	label := "Vol"
+	if v.Alias != "" {
+		label = v.Alias
 	}
 
 	block := new(i3bar.Block)
@@ -139,15 +78,19 @@ func (g *PulseaudioVolume) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
 	block.Instance = g.Sink
 
 	if v.Muted {
-		block.FullText = "Vol: muted"
+		block.FullText = label + ": muted"
 		block.ShortText = "V: mute"
 		block.TextColor = colors.Warning
-	} else if v.Left == v.Right {
-		block.FullText = fmt.Sprintf("Vol: %d%%", v.Left)
-		block.ShortText = fmt.Sprintf("V: %d%%", v.Left)
+	} else if len(v.Channels) == 2 && v.Left != v.Right {
+		block.FullText = fmt.Sprintf("%s: L%d%% R%d%%", label, v.Left, v.Right)
+		block.ShortText = fmt.Sprintf("V: %d%%", v.Percent)
 	} else {
-		block.FullText = fmt.Sprintf("Vol: L%d%% R%d%%", v.Left, v.Right)
-		block.ShortText = fmt.Sprintf("V: %d%%", v.Left)
+		block.FullText = fmt.Sprintf("%s: %d%%", label, v.Percent)
+		block.ShortText = fmt.Sprintf("V: %d%%", v.Percent)
+	}
+
+	if err := g.TextFormat.apply(block, v); err != nil {
+		return nil, err
 	}
 
 	return block, nil
@@ -158,35 +101,72 @@ func (g *PulseaudioVolume) GetNameAndInstance() (string, string) {
 }
 
 func (g *PulseaudioVolume) applyVolumeDelta(percentageChange int) error {
-	// pactl set-sink-volume @DEFAULT_SINK@ +10%
-	sinkName := g.Sink
-	if sinkName == "" {
-		sinkName = "@DEFAULT_SINK@"
+	c, sink, err := g.getSink()
+	if err != nil {
+		return err
+	}
+	return c.SetSinkVolume(sink.Name, sink.Volume.AddPercent(percentageChange, 0))
+}
+
+func (g *PulseaudioVolume) toggleMute() error {
+	c, sink, err := g.getSink()
+	if err != nil {
+		return err
+	}
+	return c.SetSinkMute(sink.Name, !sink.Muted)
+}
+
+// cycleDefaultSink makes the next (or previous, if direction is negative) sink
+// the default and moves every playing stream onto it.
+func (g *PulseaudioVolume) cycleDefaultSink(direction int) error {
+	c, err := getPulseClient()
+	if err != nil {
+		return err
 	}
 
-	var percentageString string
-	if percentageChange == 0 {
+	sinks, err := c.Sinks()
+	if err != nil {
+		return err
+	}
+	if len(sinks) < 2 {
 		return nil
-	} else if percentageChange > 0 {
-		// If we have a negative number, it's prepended with - automatically,
-		// but positive numbers aren't!
-		percentageString += "+"
 	}
-	percentageString += strconv.Itoa(percentageChange)
-	percentageString += "%"
 
-	_, err := runCommand("pactl", "set-sink-volume", sinkName, percentageString)
-	return err
-}
+	info, err := c.ServerInfo()
+	if err != nil {
+		return err
+	}
 
-func (g *PulseaudioVolume) toggleMute() error {
-	// pactl set-sink-mute @DEFAULT_SINK@ toggle
-	sinkName := g.Sink
-	if sinkName == "" {
-		sinkName = "@DEFAULT_SINK@"
+	current := 0
+	for i, sink := range sinks {
+		if sink.Name == info.DefaultSinkName {
+			current = i
+			break
+		}
+	}
+	next := sinks[(current+direction+len(sinks))%len(sinks)]
+
+	if err := c.SetDefaultSink(next.Name); err != nil {
+		return err
+	}
+
+	inputs, err := c.SinkInputs()
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		if input.Sink == next.Index {
+			continue
+		}
+		if err := c.MoveSinkInput(input.Index, next.Index); err != nil {
+			// Some streams can't be moved, for example because they're
+			// tied to a particular sink, but that shouldn't stop the others
+			// from moving.
+			log.Warn().Err(err).Str("location", "pulseaudioVolume_cycleDefaultSink").Str("stream", input.Name).Msg("could not move stream")
+		}
 	}
-	_, err := runCommand("pactl", "set-sink-mute", sinkName, "toggle")
-	return err
+
+	return nil
 }
 
 func (g *PulseaudioVolume) OnClick(event *i3bar.ClickEvent) bool {
@@ -195,6 +175,17 @@ func (g *PulseaudioVolume) OnClick(event *i3bar.ClickEvent) bool {
 	switch event.Button {
 	case i3bar.LeftMouseButton:
 		err = g.toggleMute()
+	case i3bar.RightMouseButton, i3bar.MiddleMouseButton:
+		if g.Sink != "" {
+			// The block always shows the configured sink, so changing the
+			// default would have no visible effect.
+			return false
+		}
+		direction := 1
+		if event.Button == i3bar.MiddleMouseButton {
+			direction = -1
+		}
+		err = g.cycleDefaultSink(direction)
 	case i3bar.MouseWheelScrollUp:
 		err = g.applyVolumeDelta(1)
 	case i3bar.MouseWheelScrollDown:
@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/codemicro/bar/internal/i3bar"
+)
+
+// registry maps the provider names used in the config file to functions that
+// construct that provider with its default options. Constructors are called
+// before the options are validated, and again on every reload, so they
+// shouldn't do any work such as reading from /proc.
+var registry = map[string]func() i3bar.BlockGenerator{
+	"audio_player":       func() i3bar.BlockGenerator { return NewAudioPlayer(32) },
+	"battery":            func() i3bar.BlockGenerator { return NewBattery("BAT0", 80, 30, 20) },
+	"cpu":                func() i3bar.BlockGenerator { return NewCPU(20, 50) },
+	"datetime":           func() i3bar.BlockGenerator { return NewDateTime() },
+	"disk":               func() i3bar.BlockGenerator { return NewDisk("/", 30, 10) },
+	"ip_address":         func() i3bar.BlockGenerator { return NewIPAddress("") },
+	"launch_program":     func() i3bar.BlockGenerator { return NewLaunchProgram("", "") },
+	"memory":             func() i3bar.BlockGenerator { return NewMemory(7, 5) },
+	"network_throughput": func() i3bar.BlockGenerator { return NewNetworkThroughput("", 0, 0) },
+	"plain_text":         func() i3bar.BlockGenerator { return NewPlainText("") },
+	"pressure":           func() i3bar.BlockGenerator { return NewPressure(10, 30) },
+	"pulseaudio_source":  func() i3bar.BlockGenerator { return NewPulseaudioSource() },
+	"pulseaudio_volume":  func() i3bar.BlockGenerator { return NewPulseaudioVolume() },
+	"temperature":        func() i3bar.BlockGenerator { return NewTemperature(70, 85) },
+	"timer":              func() i3bar.BlockGenerator { return NewTimer(false) },
+	"vpn":                func() i3bar.BlockGenerator { return NewVPN("") },
+	"wifi":               func() i3bar.BlockGenerator { return NewWiFi("", 75) },
+}
+
+// validator may be implemented by providers that need to check their options
+// after they have been decoded from the config file.
+type validator interface {
+	validate() error
+}
+
+// OptionError is returned by New when an option has an invalid value.
+type OptionError struct {
+	// Option is the name of the option as written in the config file.
+	Option string
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Option, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// Names returns the names of every registered provider in alphabetical order.
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsRegistered reports whether a provider with the given name exists.
+func IsRegistered(providerName string) bool {
+	_, found := registry[providerName]
+	return found
+}
+
+// New constructs the provider registered as providerName. decode is called
+// with a pointer to the provider, pre-populated with its default options, and
+// should overwrite any options that have been explicitly configured.
+func New(providerName string, decode func(v any) error) (i3bar.BlockGenerator, error) {
+	newDefault, found := registry[providerName]
+	if !found {
+		return nil, fmt.Errorf("unknown provider %q", providerName)
+	}
+
+	g := newDefault()
+
+	if err := decode(g); err != nil {
+		return nil, err
+	}
+
+	if v, ok := g.(validator); ok {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
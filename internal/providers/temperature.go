@@ -0,0 +1,242 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/notify"
+)
+
+// defaultTemperatureSensors are the sensors that are used, in order, if no
+// sensor is configured. They are the package temperatures reported by the
+// coretemp (Intel) and k10temp (AMD) drivers, and the thermal zone for Intel
+// packages.
+var defaultTemperatureSensors = []string{"Package id 0", "Tctl", "Tdie", "x86_pkg_temp"}
+
+type Temperature struct {
+	// OkThreshold and WarningThreshold are in degrees Celsius. Temperatures
+	// above them are shown as a warning and bad respectively.
+	OkThreshold      float32 `toml:"ok_threshold"`
+	WarningThreshold float32 `toml:"warning_threshold"`
+	// Sensor selects which sensor to read. It can be the label of a hwmon
+	// sensor (such as "Package id 0" or "Tctl"), the name of a hwmon chip
+	// (such as "k10temp"), or the type of a thermal zone (such as
+	// "x86_pkg_temp"). If blank, a CPU package sensor is chosen if one
+	// exists, otherwise the first thermal zone is used.
+	Sensor string `toml:"sensor"`
+	// ShowFrequency shows the average frequency of all cores.
+	ShowFrequency bool `toml:"show_frequency"`
+	// SysfsRoot is where sysfs is mounted.
+	SysfsRoot string `toml:"sysfs_root"`
+	TextFormat
+	ThresholdAlert
+
+	name string
+	// sensorPath is the file that the temperature was last read from, so
+	// that sysfs doesn't have to be searched every time.
+	sensorPath string
+}
+
+func NewTemperature(okThreshold, warningThreshold float32) i3bar.BlockGenerator {
+	return &Temperature{
+		OkThreshold:      okThreshold,
+		WarningThreshold: warningThreshold,
+		ShowFrequency:    true,
+		SysfsRoot:        "/sys",
+		ThresholdAlert:   newThresholdAlert(3),
+		name:             "temperature",
+	}
+}
+
+func (g *Temperature) Frequency() uint8 {
+	return 2
+}
+
+// temperatureSensor is a file containing a temperature in millidegrees
+// Celsius, along with the names it can be selected by.
+type temperatureSensor struct {
+	path  string
+	names []string
+}
+
+// listTemperatureSensors returns every hwmon and thermal zone temperature
+// sensor, with hwmon sensors first.
+func (g *Temperature) listTemperatureSensors() []temperatureSensor {
+	var sensors []temperatureSensor
+
+	chips, _ := filepath.Glob(filepath.Join(g.SysfsRoot, "class", "hwmon", "hwmon*"))
+	sort.Strings(chips)
+	for _, chip := range chips {
+		chipName, _ := readTrimmedFile(filepath.Join(chip, "name"))
+
+		inputs, _ := filepath.Glob(filepath.Join(chip, "temp*_input"))
+		sort.Strings(inputs)
+		for i, input := range inputs {
+			sensor := temperatureSensor{path: input}
+			label, err := readTrimmedFile(strings.TrimSuffix(input, "_input") + "_label")
+			if err == nil && label != "" {
+				sensor.names = append(sensor.names, label)
+			}
+			// The chip name selects its first sensor.
+			if i == 0 && chipName != "" {
+				sensor.names = append(sensor.names, chipName)
+			}
+			sensors = append(sensors, sensor)
+		}
+	}
+
+	zones, _ := filepath.Glob(filepath.Join(g.SysfsRoot, "class", "thermal", "thermal_zone*"))
+	sort.Strings(zones)
+	for _, zone := range zones {
+		sensor := temperatureSensor{path: filepath.Join(zone, "temp")}
+		if zoneType, err := readTrimmedFile(filepath.Join(zone, "type")); err == nil {
+			sensor.names = append(sensor.names, zoneType)
+		}
+		sensors = append(sensors, sensor)
+	}
+
+	return sensors
+}
+
+func (g *Temperature) findSensor() (string, error) {
+	sensors := g.listTemperatureSensors()
+	if len(sensors) == 0 {
+		return "", errors.New("no temperature sensors found")
+	}
+
+	wanted := defaultTemperatureSensors
+	if g.Sensor != "" {
+		wanted = []string{g.Sensor}
+	}
+
+	for _, name := range wanted {
+		for _, sensor := range sensors {
+			for _, sensorName := range sensor.names {
+				if strings.EqualFold(sensorName, name) {
+					return sensor.path, nil
+				}
+			}
+		}
+	}
+
+	if g.Sensor != "" {
+		return "", fmt.Errorf("no temperature sensor called %q", g.Sensor)
+	}
+
+	// Thermal zones are listed last, so this prefers the first thermal
+	// zone over arbitrary hwmon sensors such as those on a wireless card.
+	for _, sensor := range sensors {
+		if strings.Contains(sensor.path, "thermal_zone") {
+			return sensor.path, nil
+		}
+	}
+	return sensors[0].path, nil
+}
+
+// getTemperature returns the temperature in degrees Celsius.
+func (g *Temperature) getTemperature() (float64, error) {
+	if g.sensorPath == "" {
+		path, err := g.findSensor()
+		if err != nil {
+			return 0, err
+		}
+		g.sensorPath = path
+	}
+
+	millidegrees, err := readSysfsInt(g.sensorPath)
+	if err != nil {
+		// The sensor may have moved, for example if hwmon devices were
+		// renumbered after resuming, so search again next time.
+		g.sensorPath = ""
+		return 0, err
+	}
+
+	return float64(millidegrees) / 1000, nil
+}
+
+// getFrequencies returns the current frequency of each core in MHz.
+func (g *Temperature) getFrequencies() ([]float64, error) {
+	files, err := filepath.Glob(filepath.Join(g.SysfsRoot, "devices", "system", "cpu", "cpu[0-9]*", "cpufreq", "scaling_cur_freq"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var frequencies []float64
+	for _, file := range files {
+		kHz, err := readSysfsInt(file)
+		if err != nil {
+			// Cores can go offline at any time.
+			continue
+		}
+		frequencies = append(frequencies, float64(kHz)/1000)
+	}
+	return frequencies, nil
+}
+
+// temperatureData is the data available to Temperature formats.
+type temperatureData struct {
+	Celsius float64
+	// Frequency is the average frequency of all cores in MHz, or zero if
+	// it isn't known.
+	Frequency float64
+	// Frequencies is the frequency of each core in MHz.
+	Frequencies []float64
+}
+
+func (g *Temperature) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	temperature, err := g.getTemperature()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &temperatureData{Celsius: temperature}
+
+	if data.Frequencies, err = g.getFrequencies(); err != nil {
+		return nil, err
+	}
+	if len(data.Frequencies) != 0 {
+		var sum float64
+		for _, f := range data.Frequencies {
+			sum += f
+		}
+		data.Frequency = sum / float64(len(data.Frequencies))
+	}
+
+	block := &i3bar.Block{
+		Name:      g.name,
+		Instance:  g.Sensor,
+		FullText:  fmt.Sprintf("Temp: %.0f°C", temperature),
+		ShortText: fmt.Sprintf("%.0f°C", temperature),
+	}
+
+	if g.ShowFrequency && data.Frequency != 0 {
+		block.FullText += fmt.Sprintf(" %.1fGHz", data.Frequency/1000)
+	}
+
+	t := float32(temperature)
+	if t > g.WarningThreshold && g.WarningThreshold != 0 {
+		block.TextColor = colors.Bad
+	} else if t > g.OkThreshold && g.OkThreshold != 0 {
+		block.TextColor = colors.Warning
+	}
+
+	g.ThresholdAlert.check(g.name+g.Sensor, temperature, notify.Thresholds{
+		Warning: float64(g.OkThreshold),
+		Bad:     float64(g.WarningThreshold),
+	}, "High temperature", fmt.Sprintf("CPU temperature is %.0f°C", temperature))
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (g *Temperature) GetNameAndInstance() (string, string) {
+	return g.name, g.Sensor
+}
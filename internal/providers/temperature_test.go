@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codemicro/bar/internal/i3bar"
+)
+
+// writeSysfs writes files relative to root, creating directories as needed.
+func writeSysfs(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTemperatureSensorSelection(t *testing.T) {
+	// An AMD machine with a wireless card, an NVMe drive and ACPI thermal
+	// zones.
+	amd := map[string]string{
+		"class/hwmon/hwmon0/name":          "iwlwifi_1",
+		"class/hwmon/hwmon0/temp1_input":   "38000",
+		"class/hwmon/hwmon1/name":          "nvme",
+		"class/hwmon/hwmon1/temp1_input":   "41850",
+		"class/hwmon/hwmon1/temp1_label":   "Composite",
+		"class/hwmon/hwmon1/temp2_input":   "45850",
+		"class/hwmon/hwmon1/temp2_label":   "Sensor 1",
+		"class/hwmon/hwmon2/name":          "k10temp",
+		"class/hwmon/hwmon2/temp1_input":   "52125",
+		"class/hwmon/hwmon2/temp1_label":   "Tctl",
+		"class/hwmon/hwmon2/temp3_input":   "49000",
+		"class/hwmon/hwmon2/temp3_label":   "Tccd1",
+		"class/thermal/thermal_zone0/type": "acpitz",
+		"class/thermal/thermal_zone0/temp": "27800",
+	}
+
+	// An Intel machine where coretemp isn't loaded, so only thermal zones
+	// are available.
+	intelZones := map[string]string{
+		"class/thermal/thermal_zone0/type": "acpitz",
+		"class/thermal/thermal_zone0/temp": "25000",
+		"class/thermal/thermal_zone1/type": "x86_pkg_temp",
+		"class/thermal/thermal_zone1/temp": "61000",
+	}
+
+	// A machine with no CPU package sensor at all.
+	other := map[string]string{
+		"class/hwmon/hwmon0/name":          "iwlwifi_1",
+		"class/hwmon/hwmon0/temp1_input":   "38000",
+		"class/thermal/thermal_zone0/type": "acpitz",
+		"class/thermal/thermal_zone0/temp": "27800",
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		sensor  string
+		want    float64
+		wantErr bool
+	}{
+		{name: "default prefers package sensor", files: amd, want: 52.125},
+		{name: "label", files: amd, sensor: "Tccd1", want: 49},
+		{name: "label ignores case", files: amd, sensor: "sensor 1", want: 45.85},
+		{name: "chip name selects first sensor", files: amd, sensor: "nvme", want: 41.85},
+		{name: "chip without labels", files: amd, sensor: "iwlwifi_1", want: 38},
+		{name: "zone type", files: amd, sensor: "acpitz", want: 27.8},
+		{name: "default falls back to package zone", files: intelZones, want: 61},
+		{name: "default falls back to first zone", files: other, want: 27.8},
+		{name: "missing sensor", files: amd, sensor: "coretemp", wantErr: true},
+		{name: "no sensors", files: map[string]string{}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeSysfs(t, root, test.files)
+
+			g := NewTemperature(0, 0).(*Temperature)
+			g.Sensor = test.sensor
+			g.SysfsRoot = root
+
+			got, err := g.getTemperature()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %v°C from %s, want an error", got, g.sensorPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %v°C from %s, want %v°C", got, g.sensorPath, test.want)
+			}
+		})
+	}
+}
+
+func TestTemperatureBlock(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, map[string]string{
+		"class/hwmon/hwmon0/name":                          "coretemp",
+		"class/hwmon/hwmon0/temp1_input":                   "85000",
+		"class/hwmon/hwmon0/temp1_label":                   "Package id 0",
+		"devices/system/cpu/cpu0/cpufreq/scaling_cur_freq": "2000000",
+		"devices/system/cpu/cpu1/cpufreq/scaling_cur_freq": "3000000",
+	})
+
+	g := NewTemperature(70, 90).(*Temperature)
+	g.SysfsRoot = root
+	g.Notify = false
+
+	colors := &i3bar.ColorSet{Warning: &i3bar.Color{R: 1}}
+	block, err := g.Block(colors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Temp: 85°C 2.5GHz"; block.FullText != want {
+		t.Errorf("FullText = %q, want %q", block.FullText, want)
+	}
+	if block.TextColor != colors.Warning {
+		t.Errorf("TextColor = %v, want the warning color", block.TextColor)
+	}
+}
@@ -14,7 +14,8 @@ const (
 )
 
 type Timer struct {
-	UseShortLabel bool
+	UseShortLabel bool `toml:"use_short_label"`
+	TextFormat
 	
 	times []time.Time
 
@@ -66,6 +67,13 @@ func (g *Timer) calculateDuration() time.Duration {
 	return sigma.Round(time.Second)
 }
 
+// timerData is the data available to Timer formats.
+type timerData struct {
+	Started  bool
+	Running  bool
+	Duration time.Duration
+}
+
 func (g *Timer) Block(*i3bar.ColorSet) (*i3bar.Block, error) {
 	block := &i3bar.Block{
 		Name: g.name,
@@ -89,6 +97,15 @@ func (g *Timer) Block(*i3bar.ColorSet) (*i3bar.Block, error) {
 		block.FullText = fmt.Sprintf("%s %s %s", timerSymbolClock, symbol, g.calculateDuration())
 	}
 
+	data := &timerData{
+		Started:  numStoredTimes != 0,
+		Running:  numStoredTimes%2 == 1,
+		Duration: g.calculateDuration(),
+	}
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
 	return block, nil
 }
 
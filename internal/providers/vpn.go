@@ -0,0 +1,293 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codemicro/bar/internal/i3bar"
+	"github.com/codemicro/bar/internal/wireguard"
+	"github.com/rs/zerolog/log"
+)
+
+type VPN struct {
+	// Adapter is the name of the tunnel interface to show. If blank, any
+	// WireGuard or tun interface is used, preferring one that is up.
+	Adapter string `toml:"adapter"`
+	// UpCommand and DownCommand are run when the block is left-clicked
+	// while the tunnel is down or up respectively. The first item is the
+	// program to run and the rest are its arguments, for example
+	// ["wg-quick", "up", "wg0"].
+	UpCommand   []string `toml:"up_command"`
+	DownCommand []string `toml:"down_command"`
+	// HandshakeTimeout is the number of seconds since the last WireGuard
+	// handshake before the tunnel is shown as a warning. WireGuard makes a
+	// new handshake every two minutes while traffic is flowing. Zero
+	// disables the warning.
+	HandshakeTimeout int `toml:"handshake_timeout"`
+	TextFormat
+
+	// connected is set to 1 if the tunnel was up when the block was last
+	// generated, which decides which command a click runs.
+	connected int32
+	// commandDone is sent to when a command run by a click finishes.
+	commandDone chan struct{}
+
+	name string
+}
+
+func NewVPN(adapter string) i3bar.BlockGenerator {
+	return &VPN{
+		Adapter:          adapter,
+		HandshakeTimeout: 180,
+		commandDone:      make(chan struct{}, 1),
+		name:             "vpn",
+	}
+}
+
+func (g *VPN) Frequency() uint8 {
+	return 5
+}
+
+func (g *VPN) Watch(ctx context.Context, notify func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-g.commandDone:
+			notify()
+		}
+	}
+}
+
+// tunnelKind returns "wireguard" or "tun" if the interface with the given name
+// is a tunnel, or an empty string otherwise.
+func tunnelKind(name string) string {
+	dir := filepath.Join("/sys/class/net", name)
+
+	if uevent, err := readTrimmedFile(filepath.Join(dir, "uevent")); err == nil {
+		for _, line := range strings.Split(uevent, "\n") {
+			if line == "DEVTYPE=wireguard" {
+				return "wireguard"
+			}
+		}
+	}
+
+	// tun and tap devices, as used by OpenVPN, have this file.
+	if _, err := os.Stat(filepath.Join(dir, "tun_flags")); err == nil {
+		return "tun"
+	}
+
+	// Userspace WireGuard implementations, such as wireguard-go, create
+	// tun devices, but the above should have found those.
+	if strings.HasPrefix(name, "wg") {
+		return "wireguard"
+	}
+	if strings.HasPrefix(name, "tun") {
+		return "tun"
+	}
+	return ""
+}
+
+// isInterfaceUp reports whether the interface with the given name exists and
+// has been brought up.
+func isInterfaceUp(name string) bool {
+	// IFF_UP from include/uapi/linux/if.h.
+	const iffUp = 0x1
+	flags, err := readTrimmedFile(filepath.Join("/sys/class/net", name, "flags"))
+	if err != nil {
+		return false
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(flags, "0x"), 16, 32)
+	if err != nil {
+		return false
+	}
+	return n&iffUp != 0
+}
+
+// findTunnel returns the name of the tunnel interface to show, or an empty
+// string if there isn't one.
+func (g *VPN) findTunnel() string {
+	if g.Adapter != "" {
+		return g.Adapter
+	}
+
+	dirs, _ := filepath.Glob("/sys/class/net/*")
+	sort.Strings(dirs)
+
+	var tunnels []string
+	for _, dir := range dirs {
+		if name := filepath.Base(dir); tunnelKind(name) != "" {
+			tunnels = append(tunnels, name)
+		}
+	}
+
+	for _, name := range tunnels {
+		if isInterfaceUp(name) {
+			return name
+		}
+	}
+	if len(tunnels) != 0 {
+		return tunnels[0]
+	}
+	return ""
+}
+
+// getLastHandshake returns the time of the last handshake of a WireGuard
+// interface. ok is false if it can't be read, which is usually because
+// reading it requires CAP_NET_ADMIN.
+func getLastHandshake(name string) (last time.Time, ok bool) {
+	client, err := wireguard.Dial()
+	if err != nil {
+		log.Debug().Err(err).Str("location", "vpn_getLastHandshake").Send()
+		return time.Time{}, false
+	}
+	defer client.Close()
+
+	device, err := client.Device(name)
+	if err != nil {
+		if !errors.Is(err, os.ErrPermission) {
+			log.Debug().Err(err).Str("location", "vpn_getLastHandshake").Send()
+		}
+		return time.Time{}, false
+	}
+
+	return device.LastHandshake(), true
+}
+
+// formatAge formats a duration in the largest whole unit, for example "3m".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// vpnData is the data available to VPN formats.
+type vpnData struct {
+	// Adapter is empty if no tunnel interface was found.
+	Adapter   string
+	Connected bool
+	// Kind is "wireguard" or "tun".
+	Kind string
+	// HasHandshake is true if the time of the last WireGuard handshake is
+	// known, in which case LastHandshake is set. LastHandshake is the zero
+	// time if there hasn't been a handshake yet.
+	HasHandshake  bool
+	LastHandshake time.Time
+	// HandshakeAge is the time since the last handshake.
+	HandshakeAge time.Duration
+}
+
+func (g *VPN) getData() *vpnData {
+	data := &vpnData{Adapter: g.findTunnel()}
+	if data.Adapter == "" {
+		return data
+	}
+
+	data.Connected = isInterfaceUp(data.Adapter)
+	data.Kind = tunnelKind(data.Adapter)
+
+	if data.Connected && data.Kind == "wireguard" {
+		data.LastHandshake, data.HasHandshake = getLastHandshake(data.Adapter)
+		if data.HasHandshake && !data.LastHandshake.IsZero() {
+			data.HandshakeAge = time.Since(data.LastHandshake)
+		}
+	}
+
+	return data
+}
+
+func (g *VPN) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
+	data := g.getData()
+	if data.Connected {
+		atomic.StoreInt32(&g.connected, 1)
+	} else {
+		atomic.StoreInt32(&g.connected, 0)
+	}
+
+	block := &i3bar.Block{
+		Name:     g.name,
+		Instance: g.Adapter,
+	}
+
+	label := "VPN"
+	if data.Adapter != "" {
+		label = data.Adapter
+	}
+
+	if !data.Connected {
+		block.TextColor = colors.Bad
+		block.FullText = fmt.Sprintf("%s: down", label)
+		block.ShortText = "VPN down"
+	} else {
+		block.TextColor = colors.Good
+		block.FullText = fmt.Sprintf("%s: up", label)
+		block.ShortText = "VPN up"
+
+		if data.HasHandshake {
+			if data.LastHandshake.IsZero() {
+				block.FullText += " (no handshake)"
+				block.TextColor = colors.Warning
+			} else {
+				block.FullText += fmt.Sprintf(" (%s ago)", formatAge(data.HandshakeAge))
+				if timeout := time.Duration(g.HandshakeTimeout) * time.Second; timeout != 0 && data.HandshakeAge > timeout {
+					block.TextColor = colors.Warning
+				}
+			}
+		}
+	}
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (g *VPN) GetNameAndInstance() (string, string) {
+	return g.name, g.Adapter
+}
+
+func (g *VPN) OnClick(event *i3bar.ClickEvent) bool {
+	if event.Button != i3bar.LeftMouseButton {
+		return false
+	}
+
+	command := g.UpCommand
+	if atomic.LoadInt32(&g.connected) == 1 {
+		command = g.DownCommand
+	}
+	if len(command) == 0 {
+		return false
+	}
+
+	// Bringing a tunnel up can take a while, so the block is refreshed once
+	// the command has finished rather than straight away.
+	go func() {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.SysProcAttr = ownProcessGroup()
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			log.Error().Err(err).Str("location", "vpn_OnClick").Str("output", strings.TrimSpace(string(out))).Msg("Could not run command")
+		}
+		select {
+		case g.commandDone <- struct{}{}:
+		default:
+		}
+	}()
+	return false
+}
@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// watchState records whether a provider's watcher is currently running, so
+// that the provider can poll less frequently while it is.
+type watchState struct {
+	running int32
+}
+
+func (w *watchState) set(running bool) {
+	var x int32
+	if running {
+		x = 1
+	}
+	atomic.StoreInt32(&w.running, x)
+}
+
+func (w *watchState) isRunning() bool {
+	return atomic.LoadInt32(&w.running) == 1
+}
+
+// watchCommand runs a long-lived command and calls notify every time it prints
+// a line for which shouldNotify returns true. It returns when the command exits
+// or ctx is cancelled.
+func watchCommand(ctx context.Context, state *watchState, notify func(), shouldNotify func(line string) bool, program string, args ...string) error {
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.SysProcAttr = ownProcessGroup()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	state.set(true)
+	defer state.set(false)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if shouldNotify(scanner.Text()) {
+			notify()
+		}
+	}
+
+	return cmd.Wait()
+}
+
+// watchUevents listens for kernel uevents and calls notify for every event
+// from the given subsystem (for example, "power_supply"). It returns when ctx
+// is cancelled.
+func watchUevents(ctx context.Context, state *watchState, notify func(), subsystem string) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return err
+	}
+
+	// Group 1 is events broadcast by the kernel, as opposed to udev.
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		_ = syscall.Close(fd)
+		return err
+	}
+
+	// As the socket is non-blocking, os.NewFile registers it with the runtime
+	// poller and closing the file will interrupt a pending Read. The file is
+	// closed when ctx is cancelled, or when this function returns for any
+	// other reason.
+	f := os.NewFile(uintptr(fd), "uevent")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = f.Close()
+	}()
+
+	state.set(true)
+	defer state.set(false)
+
+	subsystemField := "SUBSYSTEM=" + subsystem
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		// Events are a series of null-terminated strings, the first being a
+		// header and the remainder being KEY=value pairs.
+		for _, field := range strings.Split(string(buf[:n]), "\x00") {
+			if field == subsystemField {
+				notify()
+				break
+			}
+		}
+	}
+}
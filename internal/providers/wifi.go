@@ -1,18 +1,24 @@
 package providers
 
 import (
+	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/codemicro/bar/internal/i3bar"
-	"github.com/samber/lo"
+	"github.com/codemicro/bar/internal/nl80211"
 )
 
 type WiFi struct {
-	Adapter     string
-	OkThreshold float32
+	// Adapter is the name of the wireless interface to show. If blank, the
+	// interface used by the default route is shown if it is wireless,
+	// otherwise the first wireless interface is used.
+	Adapter     string  `toml:"adapter"`
+	OkThreshold float32 `toml:"ok_threshold"`
+	// ShowBitrate shows the transmit bitrate of the connection.
+	ShowBitrate bool `toml:"show_bitrate"`
+	TextFormat
 
 	name string
 }
@@ -30,71 +36,140 @@ func (g *WiFi) Frequency() uint8 {
 	return 5
 }
 
-var (
-	// For use with iwconfig
-	essidRegexp       = regexp.MustCompile(`ESSID:(?:"(.+)"|off/any)`)
-	frequencyRegexp   = regexp.MustCompile(`Frequency:(\d(?:\.\d+)? [a-zA-Z]Hz)`)
-	linkQualityRegexp = regexp.MustCompile(`Link Quality=(\d+\/\d+)`)
-)
+// findInterface returns the wireless interface to show.
+func (g *WiFi) findInterface(client *nl80211.Client) (*nl80211.Interface, error) {
+	if g.Adapter != "" {
+		return client.Interface(g.Adapter)
+	}
 
-func (g *WiFi) getConnectionInfo() (ssid, frequency string, linkQuality float32, err error) {
-	output, err := runCommand("iwconfig")
+	interfaces, err := client.Interfaces()
 	if err != nil {
-		return "", "", 0, err
+		return nil, err
 	}
 
-	adapters := lo.Filter(strings.Split(string(output), "\n\n"), func(x string, _ int) bool {
-		return x != ""
-	})
-
-	for _, adapterInfo := range adapters {
-		if !strings.HasPrefix(adapterInfo, g.Adapter) {
-			continue
-		}
-
-		if essidRegexp.MatchString(adapterInfo) {
-			ssid = essidRegexp.FindStringSubmatch(adapterInfo)[1]
+	if name, err := defaultRouteInterface(); err == nil {
+		for _, iface := range interfaces {
+			if iface.Name == name {
+				return iface, nil
+			}
 		}
+	}
 
-		if frequencyRegexp.MatchString(adapterInfo) {
-			frequency = frequencyRegexp.FindStringSubmatch(adapterInfo)[1]
+	for _, iface := range interfaces {
+		if iface.Station {
+			return iface, nil
 		}
+	}
+	return nil, nl80211.ErrNotFound
+}
 
-		if linkQualityRegexp.MatchString(adapterInfo) {
-			eqn := linkQualityRegexp.FindStringSubmatch(adapterInfo)[1]
-			sp := strings.Split(eqn, "/")
-			num, _ := strconv.Atoi(sp[0])
-			denom, _ := strconv.Atoi(sp[1])
-			linkQuality = (float32(num) / float32(denom)) * 100
-		}
+// linkQuality converts a signal strength in dBm to a percentage, using the
+// same scale as iwconfig, which treats -110dBm as 0% and -40dBm as 100%.
+func linkQuality(signal int) float32 {
+	quality := signal + 110
+	if quality < 0 {
+		quality = 0
+	} else if quality > 70 {
+		quality = 70
 	}
+	return float32(quality) / 70 * 100
+}
 
-	return
+// wifiData is the data available to WiFi formats.
+type wifiData struct {
+	Adapter string
+	// SSID is empty if the adapter is not connected.
+	SSID string
+	// Frequency is formatted like "2.412 GHz".
+	Frequency    string
+	FrequencyMHz int
+	LinkQuality  float32
+	// Signal is the signal strength in dBm.
+	Signal int
+	// Bitrate is the transmit bitrate in Mbit/s.
+	Bitrate float64
 }
 
-func (g *WiFi) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
-	ssid, frequency, linkQuality, err := g.getConnectionInfo()
+func (g *WiFi) getData() (*wifiData, error) {
+	client, err := nl80211.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	iface, err := g.findInterface(client)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &wifiData{Adapter: iface.Name}
+
+	link, err := client.Link(iface)
 	if err != nil {
 		return nil, err
 	}
+	if link == nil {
+		return data, nil
+	}
+
+	data.SSID = link.SSID
+	data.FrequencyMHz = link.Frequency
+	if link.Frequency != 0 {
+		data.Frequency = strconv.FormatFloat(float64(link.Frequency)/1000, 'f', -1, 64) + " GHz"
+	}
+	data.Signal = link.Signal
+	data.LinkQuality = linkQuality(link.Signal)
+	data.Bitrate = float64(link.TxBitrate) / 1e6
 
+	return data, nil
+}
+
+func (g *WiFi) Block(colors *i3bar.ColorSet) (*i3bar.Block, error) {
 	block := &i3bar.Block{
 		Name:     g.name,
 		Instance: g.Adapter,
 	}
 
-	if ssid == "" {
+	data, err := g.getData()
+	if errors.Is(err, nl80211.ErrNotFound) {
+		// The adapter can disappear at any time, for example if it's a USB
+		// adapter or has been disabled with rfkill.
+		data = &wifiData{Adapter: g.Adapter}
 		block.TextColor = colors.Bad
-		block.FullText = fmt.Sprintf("%s not connected", g.Adapter)
+		if g.Adapter == "" {
+			block.FullText = "no WiFi adapter"
+		} else {
+			block.FullText = fmt.Sprintf("%s not found", g.Adapter)
+		}
+		block.ShortText = "not found"
+	} else if err != nil {
+		return nil, err
+	} else if data.SSID == "" {
+		block.TextColor = colors.Bad
+		block.FullText = fmt.Sprintf("%s not connected", data.Adapter)
 		block.ShortText = "not connected"
 	} else {
+		block.TextColor = colors.Good
 
-		if linkQuality < g.OkThreshold && g.OkThreshold != 0 {
-			block.TextColor = colors.Warning
+		var qualityColor *i3bar.Color
+		if data.LinkQuality < g.OkThreshold && g.OkThreshold != 0 {
+			qualityColor = colors.Warning
 		}
 
-		block.TextColor = colors.Good
-		block.FullText = fmt.Sprintf("%s (%s) %.0f%%", ssid, strings.ReplaceAll(frequency, " ", ""), linkQuality)
+		text := i3bar.NewPangoText(data.SSID)
+		if data.Frequency != "" {
+			text.Text(fmt.Sprintf(" (%s)", strings.ReplaceAll(data.Frequency, " ", "")))
+		}
+		text.Text(" ").Colored(qualityColor, fmt.Sprintf("%.0f%%", data.LinkQuality))
+		if g.ShowBitrate && data.Bitrate != 0 {
+			text.Text(fmt.Sprintf(" %.0fMbit/s", data.Bitrate))
+		}
+
+		block.SetPango(text, nil)
+	}
+
+	if err := g.TextFormat.apply(block, data); err != nil {
+		return nil, err
 	}
 
 	return block, nil
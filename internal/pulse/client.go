@@ -0,0 +1,350 @@
+// Package pulse is a minimal client for the PulseAudio native protocol. It
+// works with both PulseAudio and PipeWire (through pipewire-pulse).
+package pulse
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// protocolVersion is the highest version of the native protocol that this
+// package understands. The server will use whichever is lower out of this and
+// its own version.
+const protocolVersion = 32
+
+const (
+	commandError          = 0
+	commandReply          = 2
+	commandAuth           = 8
+	commandSetClientName  = 9
+	commandSubscribeEvent = 66
+
+	descriptorSize = 20
+	controlChannel = 0xFFFFFFFF
+	cookieLength   = 256
+	requestTimeout = 5 * time.Second
+)
+
+// ErrClosed is returned by requests made on a closed connection.
+var ErrClosed = errors.New("pulse: connection closed")
+
+// ServerError is an error code returned by the server in response to a
+// request.
+type ServerError uint32
+
+var serverErrorNames = map[ServerError]string{
+	1:  "access denied",
+	2:  "unknown command",
+	3:  "invalid argument",
+	4:  "entity exists",
+	5:  "no such entity",
+	6:  "connection refused",
+	7:  "protocol error",
+	8:  "timeout",
+	9:  "no authentication key",
+	10: "internal error",
+	11: "connection terminated",
+	12: "entity killed",
+	13: "invalid server",
+	14: "module initialisation failed",
+	15: "bad state",
+	16: "no data",
+	17: "incompatible protocol version",
+	18: "too large",
+	19: "not supported",
+}
+
+func (e ServerError) Error() string {
+	if name, found := serverErrorNames[e]; found {
+		return "pulse: " + name
+	}
+	return fmt.Sprintf("pulse: server error %d", uint32(e))
+}
+
+type reply struct {
+	r   *tagReader
+	err error
+}
+
+// Client is a connection to a PulseAudio server. All methods are safe to call
+// from multiple goroutines.
+type Client struct {
+	conn    net.Conn
+	version uint32
+
+	writeLock sync.Mutex
+
+	lock    sync.Mutex
+	nextTag uint32
+	pending map[uint32]chan *reply
+	err     error
+
+	events chan Event
+	done   chan struct{}
+}
+
+// DefaultAddress returns the address of the PulseAudio server to connect to,
+// using $PULSE_SERVER if it's set to a Unix socket and the default socket in
+// the user's runtime directory otherwise.
+func DefaultAddress() string {
+	if server := os.Getenv("PULSE_SERVER"); strings.HasPrefix(server, "unix:") {
+		return strings.TrimPrefix(server, "unix:")
+	} else if strings.HasPrefix(server, "/") {
+		return server
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(runtimeDir, "pulse", "native")
+}
+
+// readCookie returns the authentication cookie for the current user. If there
+// is no cookie, an empty one is returned, which is accepted by servers that
+// don't use cookie authentication (such as pipewire-pulse).
+func readCookie() []byte {
+	var candidates []string
+	if x := os.Getenv("PULSE_COOKIE"); x != "" {
+		candidates = append(candidates, x)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "pulse", "cookie"))
+	}
+	if dir, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, ".pulse-cookie"))
+	}
+
+	for _, candidate := range candidates {
+		if cookie, err := os.ReadFile(candidate); err == nil && len(cookie) == cookieLength {
+			return cookie
+		}
+	}
+
+	return make([]byte, cookieLength)
+}
+
+// Dial connects to the PulseAudio server at DefaultAddress.
+func Dial(clientName string) (*Client, error) {
+	return DialAddress(DefaultAddress(), clientName)
+}
+
+// DialAddress connects to the PulseAudio server listening on the Unix socket
+// at address and authenticates with it.
+func DialAddress(address, clientName string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", address, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:    conn,
+		version: protocolVersion,
+		pending: make(map[uint32]chan *reply),
+		events:  make(chan Event, 16),
+		done:    make(chan struct{}),
+	}
+
+	go c.readLoop()
+
+	r, err := c.request(commandAuth, new(tagWriter).u32(protocolVersion).arbitrary(readCookie()))
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	// The upper bits of the server's version are flags for shared memory
+	// support, which isn't used here.
+	serverVersion := r.u32() & 0xFFFF
+	if r.err != nil {
+		_ = c.Close()
+		return nil, r.err
+	}
+	if serverVersion < 13 {
+		_ = c.Close()
+		return nil, fmt.Errorf("pulse: unsupported protocol version %d", serverVersion)
+	}
+	if serverVersion < c.version {
+		c.version = serverVersion
+	}
+
+	if _, err := c.request(commandSetClientName, new(tagWriter).propList(map[string]string{
+		"application.name": clientName,
+	})); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes the connection. Any pending requests will fail and the channel
+// returned by Events will be closed.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done returns a channel that's closed when the connection is closed, either
+// by Close or because of an error.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that caused the connection to close, if any.
+func (c *Client) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+// request sends a command to the server and waits for the reply.
+func (c *Client) request(command uint32, args *tagWriter) (*tagReader, error) {
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return nil, c.err
+	}
+	tag := c.nextTag
+	c.nextTag += 1
+	replyChan := make(chan *reply, 1)
+	c.pending[tag] = replyChan
+	c.lock.Unlock()
+
+	payload := new(tagWriter).u32(command).u32(tag)
+	if args != nil {
+		payload.buf.Write(args.bytes())
+	}
+
+	if err := c.writePacket(payload.bytes()); err != nil {
+		c.lock.Lock()
+		delete(c.pending, tag)
+		c.lock.Unlock()
+		return nil, err
+	}
+
+	select {
+	case rep := <-replyChan:
+		return rep.r, rep.err
+	case <-time.After(requestTimeout):
+		c.lock.Lock()
+		delete(c.pending, tag)
+		c.lock.Unlock()
+		return nil, errors.New("pulse: timed out waiting for reply")
+	}
+}
+
+func (c *Client) writePacket(payload []byte) error {
+	descriptor := make([]byte, descriptorSize)
+	binary.BigEndian.PutUint32(descriptor[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(descriptor[4:], controlChannel)
+	// The remaining fields (offset and flags) are only used for memory
+	// blocks, and are zero for control packets.
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	_, err := c.conn.Write(append(descriptor, payload...))
+	return err
+}
+
+func (c *Client) readLoop() {
+	err := c.readPackets()
+
+	c.lock.Lock()
+	if err == nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+		err = ErrClosed
+	}
+	c.err = err
+	for tag, replyChan := range c.pending {
+		replyChan <- &reply{err: err}
+		delete(c.pending, tag)
+	}
+	c.lock.Unlock()
+
+	_ = c.conn.Close()
+	close(c.events)
+	close(c.done)
+}
+
+func (c *Client) readPackets() error {
+	descriptor := make([]byte, descriptorSize)
+	for {
+		if _, err := io.ReadFull(c.conn, descriptor); err != nil {
+			return err
+		}
+
+		length := binary.BigEndian.Uint32(descriptor[0:])
+		channel := binary.BigEndian.Uint32(descriptor[4:])
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.conn, payload); err != nil {
+			return err
+		}
+
+		if channel != controlChannel {
+			// Memory blocks are only sent for streams, which aren't used.
+			continue
+		}
+
+		c.handlePacket(payload)
+	}
+}
+
+func (c *Client) handlePacket(payload []byte) {
+	r := newTagReader(payload)
+	command := r.u32()
+	tag := r.u32()
+	if r.err != nil {
+		return
+	}
+
+	switch command {
+	case commandReply, commandError:
+		c.lock.Lock()
+		replyChan, found := c.pending[tag]
+		delete(c.pending, tag)
+		c.lock.Unlock()
+
+		if !found {
+			return
+		}
+
+		if command == commandError {
+			code := r.u32()
+			if r.err != nil {
+				replyChan <- &reply{err: r.err}
+			} else {
+				replyChan <- &reply{err: ServerError(code)}
+			}
+			return
+		}
+
+		replyChan <- &reply{r: r}
+
+	case commandSubscribeEvent:
+		event := Event{}
+		eventType := r.u32()
+		event.Index = r.u32()
+		if r.err != nil {
+			return
+		}
+		event.Facility = Facility(eventType & facilityMask)
+		event.Type = EventType(eventType & eventTypeMask)
+
+		select {
+		case c.events <- event:
+		default:
+			// Events are only used as a signal that something changed, so
+			// dropping some when nobody is keeping up is fine.
+		}
+	}
+}
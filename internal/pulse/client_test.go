@@ -0,0 +1,505 @@
+package pulse
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is a PulseAudio server that speaks just enough of the native
+// protocol to test the client against.
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+
+	lock        sync.Mutex
+	sinks       []*Device
+	defaultSink string
+	inputs      []*SinkInput
+	authVersion uint32
+	clientName  string
+	// subscribed is the mask the client last subscribed with.
+	subscribed uint32
+	// conn is the connection of the client, so that events can be sent.
+	conn      net.Conn
+	writeLock sync.Mutex
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, string) {
+	address := filepath.Join(t.TempDir(), "native")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeServer{
+		t:        t,
+		listener: listener,
+		sinks: []*Device{
+			{
+				Index:       0,
+				Name:        "speakers",
+				Description: "Built-in Speakers",
+				ChannelMap:  []ChannelPosition{ChannelFrontLeft, ChannelFrontRight},
+				Volume:      ChannelVolumes{VolumeNorm / 2, VolumeNorm / 2},
+				Properties:  map[string]string{"device.description": "Built-in Speakers"},
+			},
+			{
+				Index:       1,
+				Name:        "headphones",
+				Description: "USB Headphones",
+				ChannelMap:  []ChannelPosition{ChannelMono},
+				Volume:      ChannelVolumes{VolumeNorm},
+				Muted:       true,
+			},
+		},
+		defaultSink: "speakers",
+		inputs: []*SinkInput{
+			{Index: 7, Name: "music", Sink: 0, Volume: ChannelVolumes{VolumeNorm, VolumeNorm}},
+		},
+	}
+
+	go s.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.lock.Lock()
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+		s.lock.Unlock()
+	})
+
+	return s, address
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conn = conn
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	descriptor := make([]byte, descriptorSize)
+	for {
+		if _, err := io.ReadFull(conn, descriptor); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(descriptor))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+
+		r := newTagReader(payload)
+		command := r.u32()
+		tag := r.u32()
+		if r.err != nil {
+			s.t.Errorf("bad packet: %v", r.err)
+			return
+		}
+
+		reply, err := s.handleCommand(command, r)
+		if err != nil {
+			s.write(conn, new(tagWriter).u32(commandError).u32(tag).u32(uint32(err.(ServerError))))
+			continue
+		}
+
+		packet := new(tagWriter).u32(commandReply).u32(tag)
+		if reply != nil {
+			packet.buf.Write(reply.bytes())
+		}
+		s.write(conn, packet)
+	}
+}
+
+func (s *fakeServer) write(conn net.Conn, payload *tagWriter) {
+	descriptor := make([]byte, descriptorSize)
+	binary.BigEndian.PutUint32(descriptor[0:], uint32(payload.buf.Len()))
+	binary.BigEndian.PutUint32(descriptor[4:], controlChannel)
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_, _ = conn.Write(append(descriptor, payload.bytes()...))
+}
+
+// sendEvent sends a subscription event to the client.
+func (s *fakeServer) sendEvent(facility Facility, eventType EventType, index uint32) {
+	s.lock.Lock()
+	conn := s.conn
+	s.lock.Unlock()
+	s.write(conn, new(tagWriter).u32(commandSubscribeEvent).u32(invalidIndex).u32(uint32(facility)|uint32(eventType)).u32(index))
+}
+
+func (s *fakeServer) findSink(index uint32, name string) *Device {
+	if name == "@DEFAULT_SINK@" {
+		name = s.defaultSink
+	}
+	for _, sink := range s.sinks {
+		if (index != invalidIndex && sink.Index == index) || (name != "" && sink.Name == name) {
+			return sink
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) handleCommand(command uint32, r *tagReader) (*tagWriter, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	const errNoEntity = ServerError(5)
+
+	switch command {
+	case commandAuth:
+		s.authVersion = r.u32()
+		if cookie := r.arbitrary(); len(cookie) != cookieLength {
+			s.t.Errorf("cookie is %d bytes, want %d", len(cookie), cookieLength)
+		}
+		return new(tagWriter).u32(protocolVersion), nil
+
+	case commandSetClientName:
+		s.clientName = r.propList()["application.name"]
+		return new(tagWriter).u32(3), nil
+
+	case commandGetServerInfo:
+		w := new(tagWriter).string("pulseaudio").string("16.1").string("user").string("host")
+		writeSampleSpec(w)
+		return w.string(s.defaultSink).string("mic"), nil
+
+	case commandGetSinkInfo:
+		sink := s.findSink(r.u32(), r.string())
+		if sink == nil {
+			return nil, errNoEntity
+		}
+		w := new(tagWriter)
+		writeSink(w, sink)
+		return w, nil
+
+	case commandGetSinkInfoList:
+		w := new(tagWriter)
+		for _, sink := range s.sinks {
+			writeSink(w, sink)
+		}
+		return w, nil
+
+	case commandSetSinkVolume:
+		sink := s.findSink(r.u32(), r.string())
+		volume := r.cvolume()
+		if sink == nil {
+			return nil, errNoEntity
+		}
+		sink.Volume = volume
+		return nil, nil
+
+	case commandSetSinkMute:
+		sink := s.findSink(r.u32(), r.string())
+		muted := r.bool()
+		if sink == nil {
+			return nil, errNoEntity
+		}
+		sink.Muted = muted
+		return nil, nil
+
+	case commandSetDefaultSink:
+		name := r.string()
+		if s.findSink(invalidIndex, name) == nil {
+			return nil, errNoEntity
+		}
+		s.defaultSink = name
+		return nil, nil
+
+	case commandGetSinkInputList:
+		w := new(tagWriter)
+		for _, input := range s.inputs {
+			writeSinkInput(w, input)
+		}
+		return w, nil
+
+	case commandMoveSinkInput:
+		index, sinkIndex := r.u32(), r.u32()
+		r.string() // sink name
+		if s.findSink(sinkIndex, "") == nil {
+			return nil, errNoEntity
+		}
+		for _, input := range s.inputs {
+			if input.Index == index {
+				input.Sink = sinkIndex
+				return nil, nil
+			}
+		}
+		return nil, errNoEntity
+
+	case commandSubscribe:
+		s.subscribed = r.u32()
+		return nil, nil
+	}
+
+	return nil, ServerError(2)
+}
+
+func writeSampleSpec(w *tagWriter) {
+	w.buf.WriteByte(tagSampleSpec)
+	w.buf.Write([]byte{3, 2}) // s16le, two channels
+	_ = binary.Write(&w.buf, binary.BigEndian, uint32(44100))
+}
+
+func writeChannelMap(w *tagWriter, positions []ChannelPosition) {
+	w.buf.WriteByte(tagChannelMap)
+	w.buf.WriteByte(byte(len(positions)))
+	for _, p := range positions {
+		w.buf.WriteByte(byte(p))
+	}
+}
+
+func writeUsec(w *tagWriter, x uint64) {
+	w.buf.WriteByte(tagUsec)
+	_ = binary.Write(&w.buf, binary.BigEndian, x)
+}
+
+func writeU8(w *tagWriter, x uint8) {
+	w.buf.WriteByte(tagU8)
+	w.buf.WriteByte(x)
+}
+
+// writeSink writes a sink info reply in the layout used by protocol version
+// 32.
+func writeSink(w *tagWriter, sink *Device) {
+	w.u32(sink.Index).string(sink.Name).string(sink.Description)
+	writeSampleSpec(w)
+	writeChannelMap(w, sink.ChannelMap)
+	w.u32(0) // owner module
+	w.cvolume(sink.Volume).bool(sink.Muted)
+	w.u32(sink.Index + 100).string(sink.Name + ".monitor")
+	writeUsec(w, 0)
+	w.string("module-alsa-card.c").u32(0)
+	w.propList(sink.Properties)
+	writeUsec(w, 0)
+	w.buf.WriteByte(tagVolume)
+	_ = binary.Write(&w.buf, binary.BigEndian, uint32(VolumeNorm))
+	w.u32(0).u32(65537).u32(0) // state, volume steps, card
+	w.u32(1).string("analog-output").string("Analog Output").u32(100).u32(0)
+	w.string("analog-output")
+	writeU8(w, 1)
+	w.buf.WriteByte(tagFormatInfo)
+	writeU8(w, 1) // PCM
+	w.propList(nil)
+}
+
+// writeSinkInput writes a sink input info reply in the layout used by protocol
+// version 32.
+func writeSinkInput(w *tagWriter, input *SinkInput) {
+	w.u32(input.Index).string(input.Name)
+	w.u32(0).u32(0) // owner module, client
+	w.u32(input.Sink)
+	writeSampleSpec(w)
+	writeChannelMap(w, []ChannelPosition{ChannelFrontLeft, ChannelFrontRight})
+	w.cvolume(input.Volume)
+	writeUsec(w, 0)
+	writeUsec(w, 0)
+	w.string("").string("protocol-native.c")
+	w.bool(input.Muted)
+	w.propList(map[string]string{"application.name": input.Name})
+	w.bool(false).bool(true).bool(true)
+	w.buf.WriteByte(tagFormatInfo)
+	writeU8(w, 1)
+	w.propList(nil)
+}
+
+func sameVolumes(a, b ChannelVolumes) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func dialFake(t *testing.T) (*fakeServer, *Client) {
+	s, address := newFakeServer(t)
+	c, err := DialAddress(address, "test client")
+	if err != nil {
+		t.Fatalf("DialAddress: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return s, c
+}
+
+func TestAuth(t *testing.T) {
+	s, c := dialFake(t)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.authVersion != protocolVersion {
+		t.Errorf("client sent version %d, want %d", s.authVersion, protocolVersion)
+	}
+	if s.clientName != "test client" {
+		t.Errorf("client name is %q, want %q", s.clientName, "test client")
+	}
+	if c.version != protocolVersion {
+		t.Errorf("negotiated version %d, want %d", c.version, protocolVersion)
+	}
+}
+
+func TestSinkInfo(t *testing.T) {
+	_, c := dialFake(t)
+
+	info, err := c.ServerInfo()
+	if err != nil {
+		t.Fatalf("ServerInfo: %v", err)
+	}
+	if info.DefaultSinkName != "speakers" {
+		t.Errorf("default sink is %q, want %q", info.DefaultSinkName, "speakers")
+	}
+
+	sink, err := c.Sink("@DEFAULT_SINK@")
+	if err != nil {
+		t.Fatalf("Sink: %v", err)
+	}
+	if sink.Name != "speakers" || sink.Description != "Built-in Speakers" {
+		t.Errorf("got sink %q (%q), want speakers (Built-in Speakers)", sink.Name, sink.Description)
+	}
+	if !sameVolumes(sink.Volume, ChannelVolumes{VolumeNorm / 2, VolumeNorm / 2}) {
+		t.Errorf("volume is %v, want 50%% on both channels", sink.Volume)
+	}
+	if sink.ActivePort != "analog-output" {
+		t.Errorf("active port is %q, want analog-output", sink.ActivePort)
+	}
+	if sink.Properties["device.description"] != "Built-in Speakers" {
+		t.Errorf("properties are %v", sink.Properties)
+	}
+
+	sinks, err := c.Sinks()
+	if err != nil {
+		t.Fatalf("Sinks: %v", err)
+	}
+	if len(sinks) != 2 || sinks[1].Name != "headphones" || !sinks[1].Muted {
+		t.Errorf("Sinks returned %d sinks, want speakers and muted headphones", len(sinks))
+	}
+
+	var serverError ServerError
+	if _, err := c.Sink("missing"); !errors.As(err, &serverError) || serverError != 5 {
+		t.Errorf("Sink of a missing sink returned %v, want no such entity", err)
+	}
+}
+
+func TestSetVolume(t *testing.T) {
+	s, c := dialFake(t)
+
+	volume := ChannelVolumes{VolumeNorm, VolumeNorm / 4}
+	if err := c.SetSinkVolume("speakers", volume); err != nil {
+		t.Fatalf("SetSinkVolume: %v", err)
+	}
+	if err := c.SetSinkMute("speakers", true); err != nil {
+		t.Fatalf("SetSinkMute: %v", err)
+	}
+
+	s.lock.Lock()
+	sink := s.sinks[0]
+	s.lock.Unlock()
+	if !sameVolumes(sink.Volume, volume) {
+		t.Errorf("server has volume %v, want %v", sink.Volume, volume)
+	}
+	if !sink.Muted {
+		t.Error("sink wasn't muted")
+	}
+
+	sink, err := c.Sink("speakers")
+	if err != nil {
+		t.Fatalf("Sink: %v", err)
+	}
+	if !sameVolumes(sink.Volume, volume) || !sink.Muted {
+		t.Errorf("client read back volume %v, muted %v", sink.Volume, sink.Muted)
+	}
+}
+
+func TestMoveSinkInput(t *testing.T) {
+	s, c := dialFake(t)
+
+	inputs, err := c.SinkInputs()
+	if err != nil {
+		t.Fatalf("SinkInputs: %v", err)
+	}
+	if len(inputs) != 1 || inputs[0].Index != 7 || inputs[0].Sink != 0 {
+		t.Fatalf("SinkInputs returned %+v, want input 7 on sink 0", inputs)
+	}
+	if inputs[0].Properties["application.name"] != "music" {
+		t.Errorf("properties are %v", inputs[0].Properties)
+	}
+
+	if err := c.SetDefaultSink("headphones"); err != nil {
+		t.Fatalf("SetDefaultSink: %v", err)
+	}
+	if err := c.MoveSinkInput(7, 1); err != nil {
+		t.Fatalf("MoveSinkInput: %v", err)
+	}
+
+	s.lock.Lock()
+	defaultSink, sink := s.defaultSink, s.inputs[0].Sink
+	s.lock.Unlock()
+	if defaultSink != "headphones" {
+		t.Errorf("default sink is %q, want headphones", defaultSink)
+	}
+	if sink != 1 {
+		t.Errorf("input is on sink %d, want 1", sink)
+	}
+
+	if err := c.MoveSinkInput(7, 42); err == nil {
+		t.Error("moving an input to a missing sink succeeded")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s, c := dialFake(t)
+
+	if err := c.Subscribe(SubscribeSink | SubscribeServer); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	s.lock.Lock()
+	mask := s.subscribed
+	s.lock.Unlock()
+	if mask != uint32(SubscribeSink|SubscribeServer) {
+		t.Errorf("subscribed with mask %#x", mask)
+	}
+
+	s.sendEvent(FacilitySink, EventChange, 1)
+
+	select {
+	case event := <-c.Events():
+		want := Event{Facility: FacilitySink, Type: EventChange, Index: 1}
+		if event != want {
+			t.Errorf("got event %+v, want %+v", event, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	// Closing the connection should close the events channel and Done.
+	_ = c.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done wasn't closed")
+	}
+	if _, ok := <-c.Events(); ok {
+		t.Error("events channel wasn't closed")
+	}
+	if !errors.Is(c.Err(), ErrClosed) {
+		t.Errorf("Err returned %v, want ErrClosed", c.Err())
+	}
+}
@@ -0,0 +1,333 @@
+package pulse
+
+const (
+	commandGetServerInfo     = 20
+	commandGetSinkInfo       = 21
+	commandGetSinkInfoList   = 22
+	commandGetSourceInfo     = 23
+	commandGetSourceInfoList = 24
+	commandGetSinkInputList  = 30
+	commandSubscribe         = 35
+	commandSetSinkVolume     = 36
+	commandSetSourceVolume   = 38
+	commandSetSinkMute       = 39
+	commandSetSourceMute     = 40
+	commandSetDefaultSink    = 44
+	commandSetDefaultSource  = 45
+	commandMoveSinkInput     = 67
+)
+
+// Facility is the kind of object that an Event relates to.
+type Facility uint32
+
+const (
+	FacilitySink         Facility = 0
+	FacilitySource       Facility = 1
+	FacilitySinkInput    Facility = 2
+	FacilitySourceOutput Facility = 3
+	FacilityModule       Facility = 4
+	FacilityClient       Facility = 5
+	FacilitySampleCache  Facility = 6
+	FacilityServer       Facility = 7
+	FacilityCard         Facility = 9
+
+	facilityMask = 0x0F
+)
+
+// EventType is the kind of change that an Event describes.
+type EventType uint32
+
+const (
+	EventNew    EventType = 0x00
+	EventChange EventType = 0x10
+	EventRemove EventType = 0x20
+
+	eventTypeMask = 0x30
+)
+
+// SubscriptionMask selects which facilities events are sent for.
+type SubscriptionMask uint32
+
+const (
+	SubscribeSink         SubscriptionMask = 0x0001
+	SubscribeSource       SubscriptionMask = 0x0002
+	SubscribeSinkInput    SubscriptionMask = 0x0004
+	SubscribeSourceOutput SubscriptionMask = 0x0008
+	SubscribeServer       SubscriptionMask = 0x0080
+	SubscribeCard         SubscriptionMask = 0x0200
+)
+
+// Event is a notification from the server that an object has changed.
+type Event struct {
+	Facility Facility
+	Type     EventType
+	Index    uint32
+}
+
+// Subscribe asks the server to send events for the facilities in mask. Events
+// are delivered on the channel returned by Events.
+func (c *Client) Subscribe(mask SubscriptionMask) error {
+	_, err := c.request(commandSubscribe, new(tagWriter).u32(uint32(mask)))
+	return err
+}
+
+// Events returns a channel of events requested with Subscribe. The channel is
+// closed when the connection is closed.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// ServerInfo contains information about the server.
+type ServerInfo struct {
+	PackageName       string
+	PackageVersion    string
+	DefaultSinkName   string
+	DefaultSourceName string
+}
+
+func (c *Client) ServerInfo() (*ServerInfo, error) {
+	r, err := c.request(commandGetServerInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info := new(ServerInfo)
+	info.PackageName = r.string()
+	info.PackageVersion = r.string()
+	r.string() // user name
+	r.string() // host name
+	r.sampleSpec()
+	info.DefaultSinkName = r.string()
+	info.DefaultSourceName = r.string()
+	// The remaining fields aren't of interest.
+
+	return info, r.err
+}
+
+// Device is a sink (output) or source (input).
+type Device struct {
+	Index       uint32
+	Name        string
+	Description string
+	ChannelMap  []ChannelPosition
+	Volume      ChannelVolumes
+	Muted       bool
+	// MonitorOf is the index of the sink that this device monitors, if it's
+	// a monitor source. It is always invalid for sinks.
+	MonitorOf  uint32
+	Properties map[string]string
+	ActivePort string
+}
+
+// IsMonitor reports whether d is a source that monitors a sink.
+func (d *Device) IsMonitor() bool {
+	return d.MonitorOf != invalidIndex
+}
+
+// readDevice reads a sink or source info reply. isSink selects between the
+// two, which have slightly different layouts.
+func (c *Client) readDevice(r *tagReader, isSink bool) *Device {
+	d := new(Device)
+	d.Index = r.u32()
+	d.Name = r.string()
+	d.Description = r.string()
+	r.sampleSpec()
+	d.ChannelMap = r.channelMap()
+	r.u32() // owner module
+	d.Volume = r.cvolume()
+	d.Muted = r.bool()
+	if isSink {
+		r.u32()    // monitor source
+		r.string() // monitor source name
+		d.MonitorOf = invalidIndex
+	} else {
+		d.MonitorOf = r.u32()
+		r.string() // monitor of sink name
+	}
+	r.usec()   // latency
+	r.string() // driver
+	r.u32()    // flags
+
+	if c.version >= 13 {
+		d.Properties = r.propList()
+		r.usec() // configured latency
+	}
+
+	if c.version >= 15 {
+		r.volume() // base volume
+		r.u32()    // state
+		r.u32()    // number of volume steps
+		r.u32()    // card
+	}
+
+	if c.version >= 16 {
+		numPorts := r.u32()
+		for i := uint32(0); i < numPorts && r.err == nil; i++ {
+			r.string() // name
+			r.string() // description
+			r.u32()    // priority
+			if c.version >= 24 {
+				r.u32() // available
+			}
+		}
+		d.ActivePort = r.string()
+	}
+
+	if (isSink && c.version >= 21) || (!isSink && c.version >= 22) {
+		numFormats := r.u8()
+		for i := uint8(0); i < numFormats && r.err == nil; i++ {
+			r.formatInfo()
+		}
+	}
+
+	return d
+}
+
+func (c *Client) getDevice(command uint32, name string, isSink bool) (*Device, error) {
+	r, err := c.request(command, new(tagWriter).u32(invalidIndex).string(name))
+	if err != nil {
+		return nil, err
+	}
+	d := c.readDevice(r, isSink)
+	return d, r.err
+}
+
+func (c *Client) listDevices(command uint32, isSink bool) ([]*Device, error) {
+	r, err := c.request(command, nil)
+	if err != nil {
+		return nil, err
+	}
+	var devices []*Device
+	for len(r.b) != 0 && r.err == nil {
+		devices = append(devices, c.readDevice(r, isSink))
+	}
+	return devices, r.err
+}
+
+// Sink returns the sink with the given name. The name "@DEFAULT_SINK@" refers
+// to the default sink.
+func (c *Client) Sink(name string) (*Device, error) {
+	return c.getDevice(commandGetSinkInfo, name, true)
+}
+
+// Sinks returns every sink known to the server.
+func (c *Client) Sinks() ([]*Device, error) {
+	return c.listDevices(commandGetSinkInfoList, true)
+}
+
+// Source returns the source with the given name. The name "@DEFAULT_SOURCE@"
+// refers to the default source.
+func (c *Client) Source(name string) (*Device, error) {
+	return c.getDevice(commandGetSourceInfo, name, false)
+}
+
+// Sources returns every source known to the server, including monitors.
+func (c *Client) Sources() ([]*Device, error) {
+	return c.listDevices(commandGetSourceInfoList, false)
+}
+
+func (c *Client) setVolume(command uint32, name string, volume ChannelVolumes) error {
+	_, err := c.request(command, new(tagWriter).u32(invalidIndex).string(name).cvolume(volume))
+	return err
+}
+
+func (c *Client) setMute(command uint32, name string, muted bool) error {
+	_, err := c.request(command, new(tagWriter).u32(invalidIndex).string(name).bool(muted))
+	return err
+}
+
+// SetSinkVolume sets the volume of each channel of the named sink.
+func (c *Client) SetSinkVolume(name string, volume ChannelVolumes) error {
+	return c.setVolume(commandSetSinkVolume, name, volume)
+}
+
+// SetSinkMute mutes or unmutes the named sink.
+func (c *Client) SetSinkMute(name string, muted bool) error {
+	return c.setMute(commandSetSinkMute, name, muted)
+}
+
+// SetSourceVolume sets the volume of each channel of the named source.
+func (c *Client) SetSourceVolume(name string, volume ChannelVolumes) error {
+	return c.setVolume(commandSetSourceVolume, name, volume)
+}
+
+// SetSourceMute mutes or unmutes the named source.
+func (c *Client) SetSourceMute(name string, muted bool) error {
+	return c.setMute(commandSetSourceMute, name, muted)
+}
+
+// SetDefaultSink makes the named sink the default. New streams will play on it,
+// but existing streams must be moved with MoveSinkInput.
+func (c *Client) SetDefaultSink(name string) error {
+	_, err := c.request(commandSetDefaultSink, new(tagWriter).string(name))
+	return err
+}
+
+// SetDefaultSource makes the named source the default.
+func (c *Client) SetDefaultSource(name string) error {
+	_, err := c.request(commandSetDefaultSource, new(tagWriter).string(name))
+	return err
+}
+
+// SinkInput is a stream that's playing on a sink.
+type SinkInput struct {
+	Index uint32
+	Name  string
+	// Sink is the index of the sink that the stream is playing on.
+	Sink       uint32
+	Volume     ChannelVolumes
+	Muted      bool
+	Properties map[string]string
+}
+
+func (c *Client) readSinkInput(r *tagReader) *SinkInput {
+	s := new(SinkInput)
+	s.Index = r.u32()
+	s.Name = r.string()
+	r.u32() // owner module
+	r.u32() // client
+	s.Sink = r.u32()
+	r.sampleSpec()
+	r.channelMap()
+	s.Volume = r.cvolume()
+	r.usec()   // buffer latency
+	r.usec()   // sink latency
+	r.string() // resample method
+	r.string() // driver
+	if c.version >= 11 {
+		s.Muted = r.bool()
+	}
+	if c.version >= 13 {
+		s.Properties = r.propList()
+	}
+	if c.version >= 19 {
+		r.bool() // corked
+	}
+	if c.version >= 20 {
+		r.bool() // has volume
+		r.bool() // volume writable
+	}
+	if c.version >= 21 {
+		r.formatInfo()
+	}
+	return s
+}
+
+// SinkInputs returns every stream that's currently playing.
+func (c *Client) SinkInputs() ([]*SinkInput, error) {
+	r, err := c.request(commandGetSinkInputList, nil)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []*SinkInput
+	for len(r.b) != 0 && r.err == nil {
+		inputs = append(inputs, c.readSinkInput(r))
+	}
+	return inputs, r.err
+}
+
+// MoveSinkInput moves the stream with index input to the sink with index sink.
+func (c *Client) MoveSinkInput(input, sink uint32) error {
+	_, err := c.request(commandMoveSinkInput, new(tagWriter).u32(input).u32(sink).string(""))
+	return err
+}
@@ -0,0 +1,312 @@
+package pulse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Tags used to mark the type of each value in a tagstruct, which is the
+// serialisation format used by the PulseAudio native protocol.
+const (
+	tagString       byte = 't'
+	tagStringNull   byte = 'N'
+	tagU32          byte = 'L'
+	tagU8           byte = 'B'
+	tagU64          byte = 'R'
+	tagS64          byte = 'r'
+	tagSampleSpec   byte = 'a'
+	tagArbitrary    byte = 'x'
+	tagBooleanTrue  byte = '1'
+	tagBooleanFalse byte = '0'
+	tagTimeval      byte = 'T'
+	tagUsec         byte = 'U'
+	tagChannelMap   byte = 'm'
+	tagCVolume      byte = 'V'
+	tagPropList     byte = 'P'
+	tagVolume       byte = 'v'
+	tagFormatInfo   byte = 'f'
+)
+
+const (
+	maxChannels      = 32
+	invalidIndex     = 0xFFFFFFFF
+	propListMaxValue = 64 * 1024
+)
+
+// tagWriter builds a tagstruct.
+type tagWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *tagWriter) u32(x uint32) *tagWriter {
+	w.buf.WriteByte(tagU32)
+	_ = binary.Write(&w.buf, binary.BigEndian, x)
+	return w
+}
+
+func (w *tagWriter) string(s string) *tagWriter {
+	if s == "" {
+		w.buf.WriteByte(tagStringNull)
+		return w
+	}
+	w.buf.WriteByte(tagString)
+	w.buf.WriteString(s)
+	w.buf.WriteByte(0)
+	return w
+}
+
+func (w *tagWriter) bool(b bool) *tagWriter {
+	if b {
+		w.buf.WriteByte(tagBooleanTrue)
+	} else {
+		w.buf.WriteByte(tagBooleanFalse)
+	}
+	return w
+}
+
+func (w *tagWriter) arbitrary(b []byte) *tagWriter {
+	w.buf.WriteByte(tagArbitrary)
+	_ = binary.Write(&w.buf, binary.BigEndian, uint32(len(b)))
+	w.buf.Write(b)
+	return w
+}
+
+func (w *tagWriter) cvolume(v ChannelVolumes) *tagWriter {
+	w.buf.WriteByte(tagCVolume)
+	w.buf.WriteByte(byte(len(v)))
+	for _, x := range v {
+		_ = binary.Write(&w.buf, binary.BigEndian, x)
+	}
+	return w
+}
+
+// propList writes a property list. Values are written as null-terminated
+// strings, as is done by pa_proplist_sets.
+func (w *tagWriter) propList(props map[string]string) *tagWriter {
+	w.buf.WriteByte(tagPropList)
+	for key, value := range props {
+		w.string(key)
+		w.u32(uint32(len(value) + 1))
+		w.arbitrary(append([]byte(value), 0))
+	}
+	w.buf.WriteByte(tagStringNull)
+	return w
+}
+
+func (w *tagWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// tagReader reads values from a tagstruct. The first error encountered is
+// stored and all reads after it return zero values, so that a sequence of
+// reads can be checked for errors once at the end.
+type tagReader struct {
+	b   []byte
+	err error
+}
+
+func newTagReader(b []byte) *tagReader {
+	return &tagReader{b: b}
+}
+
+func (r *tagReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *tagReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.fail(errors.New("pulse: tagstruct too short"))
+		return nil
+	}
+	x := r.b[:n]
+	r.b = r.b[n:]
+	return x
+}
+
+func (r *tagReader) expectTag(tag byte) bool {
+	x := r.take(1)
+	if x == nil {
+		return false
+	}
+	if x[0] != tag {
+		r.fail(fmt.Errorf("pulse: expected tag %q, got %q", tag, x[0]))
+		return false
+	}
+	return true
+}
+
+func (r *tagReader) rawU32() uint32 {
+	x := r.take(4)
+	if x == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(x)
+}
+
+func (r *tagReader) rawU64() uint64 {
+	x := r.take(8)
+	if x == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(x)
+}
+
+func (r *tagReader) rawU8() uint8 {
+	x := r.take(1)
+	if x == nil {
+		return 0
+	}
+	return x[0]
+}
+
+func (r *tagReader) u32() uint32 {
+	if !r.expectTag(tagU32) {
+		return 0
+	}
+	return r.rawU32()
+}
+
+func (r *tagReader) u8() uint8 {
+	if !r.expectTag(tagU8) {
+		return 0
+	}
+	return r.rawU8()
+}
+
+func (r *tagReader) usec() uint64 {
+	if !r.expectTag(tagUsec) {
+		return 0
+	}
+	return r.rawU64()
+}
+
+func (r *tagReader) volume() uint32 {
+	if !r.expectTag(tagVolume) {
+		return 0
+	}
+	return r.rawU32()
+}
+
+func (r *tagReader) bool() bool {
+	x := r.take(1)
+	if x == nil {
+		return false
+	}
+	switch x[0] {
+	case tagBooleanTrue:
+		return true
+	case tagBooleanFalse:
+		return false
+	}
+	r.fail(fmt.Errorf("pulse: expected boolean tag, got %q", x[0]))
+	return false
+}
+
+func (r *tagReader) string() string {
+	x := r.take(1)
+	if x == nil {
+		return ""
+	}
+	switch x[0] {
+	case tagStringNull:
+		return ""
+	case tagString:
+		i := bytes.IndexByte(r.b, 0)
+		if i == -1 {
+			r.fail(errors.New("pulse: unterminated string"))
+			return ""
+		}
+		s := string(r.b[:i])
+		r.b = r.b[i+1:]
+		return s
+	}
+	r.fail(fmt.Errorf("pulse: expected string tag, got %q", x[0]))
+	return ""
+}
+
+func (r *tagReader) arbitrary() []byte {
+	if !r.expectTag(tagArbitrary) {
+		return nil
+	}
+	n := r.rawU32()
+	return r.take(int(n))
+}
+
+func (r *tagReader) sampleSpec() {
+	if !r.expectTag(tagSampleSpec) {
+		return
+	}
+	r.take(1 + 1 + 4) // format, channels, rate
+}
+
+func (r *tagReader) channelMap() []ChannelPosition {
+	if !r.expectTag(tagChannelMap) {
+		return nil
+	}
+	n := int(r.rawU8())
+	if n > maxChannels {
+		r.fail(fmt.Errorf("pulse: too many channels (%d)", n))
+		return nil
+	}
+	var positions []ChannelPosition
+	for _, x := range r.take(n) {
+		positions = append(positions, ChannelPosition(x))
+	}
+	return positions
+}
+
+func (r *tagReader) cvolume() ChannelVolumes {
+	if !r.expectTag(tagCVolume) {
+		return nil
+	}
+	n := int(r.rawU8())
+	if n > maxChannels {
+		r.fail(fmt.Errorf("pulse: too many channels (%d)", n))
+		return nil
+	}
+	volumes := make(ChannelVolumes, n)
+	for i := range volumes {
+		volumes[i] = r.rawU32()
+	}
+	return volumes
+}
+
+func (r *tagReader) propList() map[string]string {
+	if !r.expectTag(tagPropList) {
+		return nil
+	}
+	props := make(map[string]string)
+	for r.err == nil {
+		key := r.string()
+		if key == "" {
+			break
+		}
+		n := r.u32()
+		if n > propListMaxValue {
+			r.fail(fmt.Errorf("pulse: property %q too long", key))
+			break
+		}
+		value := r.arbitrary()
+		if uint32(len(value)) != n {
+			r.fail(fmt.Errorf("pulse: property %q has mismatched length", key))
+			break
+		}
+		props[key] = string(bytes.TrimSuffix(value, []byte{0}))
+	}
+	return props
+}
+
+func (r *tagReader) formatInfo() {
+	if !r.expectTag(tagFormatInfo) {
+		return
+	}
+	r.u8() // encoding
+	r.propList()
+}
@@ -0,0 +1,143 @@
+package pulse
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// VolumeMuted is the volume of a silent channel.
+	VolumeMuted = 0
+	// VolumeNorm is the volume of a channel at 100%.
+	VolumeNorm = 0x10000
+	// VolumeMax is the largest valid volume.
+	VolumeMax = 0x7FFFFFFF
+)
+
+// ChannelPosition identifies the speaker that a channel is played on.
+type ChannelPosition uint8
+
+const (
+	ChannelMono ChannelPosition = iota
+	ChannelFrontLeft
+	ChannelFrontRight
+	ChannelFrontCenter
+	ChannelRearCenter
+	ChannelRearLeft
+	ChannelRearRight
+	ChannelLFE
+	ChannelFrontLeftOfCenter
+	ChannelFrontRightOfCenter
+	ChannelSideLeft
+	ChannelSideRight
+)
+
+var channelPositionNames = []string{
+	"mono", "front-left", "front-right", "front-center", "rear-center",
+	"rear-left", "rear-right", "lfe", "front-left-of-center",
+	"front-right-of-center", "side-left", "side-right",
+}
+
+const (
+	channelAux0          = 12
+	channelTopCenter     = 44
+	channelPositionCount = channelTopCenter + 7
+)
+
+var channelTopNames = []string{
+	"top-center", "top-front-left", "top-front-right", "top-front-center",
+	"top-rear-left", "top-rear-right", "top-rear-center",
+}
+
+func (p ChannelPosition) String() string {
+	switch {
+	case int(p) < len(channelPositionNames):
+		return channelPositionNames[p]
+	case p < channelTopCenter:
+		return fmt.Sprintf("aux%d", p-channelAux0)
+	case p < channelPositionCount:
+		return channelTopNames[p-channelTopCenter]
+	}
+	return fmt.Sprintf("unknown-%d", uint8(p))
+}
+
+// ChannelVolumes is the volume of each channel of a device, in the same order
+// as the device's channel map.
+type ChannelVolumes []uint32
+
+// Percent converts a single channel volume into a percentage, where 100 is
+// VolumeNorm.
+func Percent(volume uint32) int {
+	return int(math.Round(float64(volume) * 100 / VolumeNorm))
+}
+
+// Average returns the mean volume of all channels.
+func (v ChannelVolumes) Average() uint32 {
+	if len(v) == 0 {
+		return VolumeMuted
+	}
+	var sum uint64
+	for _, x := range v {
+		sum += uint64(x)
+	}
+	return uint32(sum / uint64(len(v)))
+}
+
+// Max returns the volume of the loudest channel.
+func (v ChannelVolumes) Max() uint32 {
+	var max uint32
+	for _, x := range v {
+		if x > max {
+			max = x
+		}
+	}
+	return max
+}
+
+// Percent returns the volume of each channel as a percentage.
+func (v ChannelVolumes) Percent() []int {
+	percentages := make([]int, len(v))
+	for i, x := range v {
+		percentages[i] = Percent(x)
+	}
+	return percentages
+}
+
+// Equal reports whether every channel has the same volume.
+func (v ChannelVolumes) Equal() bool {
+	for _, x := range v {
+		if x != v[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// AddPercent returns a copy of v with percent added to the volume of every
+// channel, keeping the balance between channels. The result is clamped between
+// VolumeMuted and limitPercent, which is ignored if zero.
+func (v ChannelVolumes) AddPercent(percent int, limitPercent int) ChannelVolumes {
+	limit := int64(VolumeMax)
+	if limitPercent > 0 {
+		limit = int64(limitPercent) * VolumeNorm / 100
+	}
+
+	delta := int64(percent) * VolumeNorm / 100
+	n := make(ChannelVolumes, len(v))
+	for i, x := range v {
+		y := int64(x) + delta
+		if y < VolumeMuted {
+			y = VolumeMuted
+		}
+		if delta > 0 && y > limit {
+			// Channels that are already above the limit are left where
+			// they are rather than being made quieter.
+			y = limit
+			if int64(x) > y {
+				y = int64(x)
+			}
+		}
+		n[i] = uint32(y)
+	}
+	return n
+}
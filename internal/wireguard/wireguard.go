@@ -0,0 +1,184 @@
+// Package wireguard reads the state of WireGuard interfaces from the kernel
+// using the wireguard generic netlink family.
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+const familyName = "wireguard"
+
+// Commands and attributes from include/uapi/linux/wireguard.h.
+const (
+	cmdGetDevice = 0
+
+	deviceIfname = 2
+	devicePeers  = 8
+
+	peerPublicKey         = 1
+	peerLastHandshakeTime = 6
+	peerRxBytes           = 7
+	peerTxBytes           = 8
+)
+
+// ErrNotFound is returned when an interface doesn't exist or isn't a
+// WireGuard interface.
+var ErrNotFound = errors.New("wireguard: no such device")
+
+// Device is a WireGuard interface.
+type Device struct {
+	Name  string
+	Peers []Peer
+}
+
+// Peer is a peer of a WireGuard interface.
+type Peer struct {
+	PublicKey []byte
+	// LastHandshake is the zero time if there hasn't been a handshake with
+	// the peer.
+	LastHandshake time.Time
+	RxBytes       uint64
+	TxBytes       uint64
+}
+
+// LastHandshake returns the time of the most recent handshake with any peer,
+// or the zero time if there hasn't been one.
+func (d *Device) LastHandshake() time.Time {
+	var latest time.Time
+	for _, peer := range d.Peers {
+		if peer.LastHandshake.After(latest) {
+			latest = peer.LastHandshake
+		}
+	}
+	return latest
+}
+
+// Client is a connection to the wireguard netlink family.
+type Client struct {
+	conn   *genetlink.Conn
+	family genetlink.Family
+}
+
+// Dial connects to the wireguard family. ErrNotFound is returned if the
+// WireGuard module isn't loaded.
+func Dial() (*Client, error) {
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := conn.GetFamily(familyName)
+	if err != nil {
+		_ = conn.Close()
+		// The family is only registered once the module is loaded, so if
+		// it doesn't exist there can't be any WireGuard interfaces.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("wireguard: %w", err)
+	}
+
+	return &Client{conn: conn, family: family}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Device returns the WireGuard interface with the given name. Reading a
+// device requires CAP_NET_ADMIN, and fails with os.ErrPermission without it.
+func (c *Client) Device(name string) (*Device, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.String(deviceIfname, name)
+	data, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := c.conn.Execute(genetlink.Message{
+		Header: genetlink.Header{
+			Command: cmdGetDevice,
+			Version: c.family.Version,
+		},
+		Data: data,
+	}, c.family.ID, netlink.Request|netlink.Dump)
+	if err != nil {
+		// ENODEV is returned if there's no interface with that name, and
+		// EOPNOTSUPP if it isn't a WireGuard interface.
+		if errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	// Devices with many peers are split across several messages, each of
+	// which lists some of the peers.
+	device := &Device{Name: name}
+	for _, msg := range msgs {
+		ad, err := netlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		for ad.Next() {
+			if ad.Type() != devicePeers {
+				continue
+			}
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				// Each peer is nested inside an attribute whose type is
+				// its index.
+				for nad.Next() {
+					nad.Nested(func(pad *netlink.AttributeDecoder) error {
+						peer, err := parsePeer(pad)
+						if err != nil {
+							return err
+						}
+						device.Peers = append(device.Peers, peer)
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return device, nil
+}
+
+func parsePeer(ad *netlink.AttributeDecoder) (Peer, error) {
+	var peer Peer
+	for ad.Next() {
+		switch ad.Type() {
+		case peerPublicKey:
+			peer.PublicKey = ad.Bytes()
+		case peerLastHandshakeTime:
+			// This is a struct __kernel_timespec, which is two 64 bit
+			// integers in the host's byte order.
+			b := ad.Bytes()
+			if len(b) < 16 {
+				continue
+			}
+			sec := int64(native.Endian.Uint64(b[:8]))
+			nsec := int64(native.Endian.Uint64(b[8:16]))
+			if sec != 0 || nsec != 0 {
+				peer.LastHandshake = time.Unix(sec, nsec)
+			}
+		case peerRxBytes:
+			peer.RxBytes = ad.Uint64()
+		case peerTxBytes:
+			peer.TxBytes = ad.Uint64()
+		}
+	}
+	return peer, ad.Err()
+}
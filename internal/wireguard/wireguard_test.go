@@ -0,0 +1,98 @@
+package wireguard
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+)
+
+// Attributes of allowed IPs, which parsePeer should skip over.
+const (
+	peerAllowedIPs = 9
+
+	allowedIPFamily   = 1
+	allowedIPIPAddr   = 2
+	allowedIPCIDRMask = 3
+)
+
+func encodeTimespec(t time.Time) []byte {
+	b := make([]byte, 16)
+	native.Endian.PutUint64(b[:8], uint64(t.Unix()))
+	native.Endian.PutUint64(b[8:], uint64(t.Nanosecond()))
+	return b
+}
+
+func TestParsePeer(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	handshake := time.Unix(1700000000, 500)
+
+	tests := []struct {
+		name   string
+		encode func(ae *netlink.AttributeEncoder)
+		want   Peer
+	}{
+		{
+			name: "allowed IPs",
+			encode: func(ae *netlink.AttributeEncoder) {
+				ae.Bytes(peerPublicKey, key)
+				ae.Bytes(peerLastHandshakeTime, encodeTimespec(handshake))
+				ae.Uint64(peerRxBytes, 1234)
+				ae.Uint64(peerTxBytes, 5678)
+				ae.Nested(peerAllowedIPs, func(nae *netlink.AttributeEncoder) error {
+					nae.Nested(0, func(ipae *netlink.AttributeEncoder) error {
+						ipae.Uint16(allowedIPFamily, 2)
+						ipae.Bytes(allowedIPIPAddr, []byte{10, 0, 0, 0})
+						ipae.Uint8(allowedIPCIDRMask, 24)
+						return nil
+					})
+					return nil
+				})
+			},
+			want: Peer{PublicKey: key, LastHandshake: handshake, RxBytes: 1234, TxBytes: 5678},
+		},
+		{
+			name: "no handshake",
+			encode: func(ae *netlink.AttributeEncoder) {
+				ae.Bytes(peerPublicKey, key)
+				ae.Bytes(peerLastHandshakeTime, make([]byte, 16))
+				ae.Uint64(peerRxBytes, 0)
+				ae.Uint64(peerTxBytes, 0)
+			},
+			want: Peer{PublicKey: key},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ae := netlink.NewAttributeEncoder()
+			test.encode(ae)
+			b, err := ae.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ad, err := netlink.NewAttributeDecoder(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parsePeer(ad)
+			if err != nil {
+				t.Fatalf("parsePeer returned error: %v", err)
+			}
+
+			if !bytes.Equal(got.PublicKey, test.want.PublicKey) {
+				t.Errorf("PublicKey = %x, want %x", got.PublicKey, test.want.PublicKey)
+			}
+			if !got.LastHandshake.Equal(test.want.LastHandshake) {
+				t.Errorf("LastHandshake = %v, want %v", got.LastHandshake, test.want.LastHandshake)
+			}
+			if got.RxBytes != test.want.RxBytes || got.TxBytes != test.want.TxBytes {
+				t.Errorf("RxBytes, TxBytes = %d, %d, want %d, %d", got.RxBytes, got.TxBytes, test.want.RxBytes, test.want.TxBytes)
+			}
+		})
+	}
+}